@@ -1,8 +1,10 @@
 package config
 
 import (
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,6 +28,57 @@ type Config struct {
 	SMTPPass  string `mapstructure:"SMTP_PASS"`
 	SMTPPort  int    `mapstructure:"SMTP_PORT"`
 	SMTPUser  string `mapstructure:"SMTP_USER"`
+
+	TrashRetention time.Duration `mapstructure:"TRASH_RETENTION"`
+	PurgeInterval  time.Duration `mapstructure:"PURGE_INTERVAL"`
+
+	ExportDir       string        `mapstructure:"EXPORT_DIR"`
+	ExportRetention time.Duration `mapstructure:"EXPORT_RETENTION"`
+
+	AccountDeletionGrace time.Duration `mapstructure:"ACCOUNT_DELETION_GRACE"`
+
+	PasswordMinLength     int    `mapstructure:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength     int    `mapstructure:"PASSWORD_MAX_LENGTH"`
+	PasswordMinClasses    int    `mapstructure:"PASSWORD_MIN_CLASSES"`
+	PasswordMinScore      int    `mapstructure:"PASSWORD_MIN_SCORE"`
+	PasswordCheckBreached bool   `mapstructure:"PASSWORD_CHECK_BREACHED"`
+	BreachedPasswordsFile string `mapstructure:"BREACHED_PASSWORDS_FILE"`
+
+	OIDCProviders []OIDCProvider `mapstructure:"OIDC_PROVIDERS"`
+
+	OAuthRefreshTokenExpiresIn time.Duration `mapstructure:"OAUTH_REFRESH_TOKEN_EXPIRED_IN"`
+
+	MagicLinkExpiresIn time.Duration `mapstructure:"MAGIC_LINK_EXPIRED_IN"`
+
+	CookieSecure       bool          `mapstructure:"COOKIE_SECURE"`
+	CookieSameSite     http.SameSite `mapstructure:"COOKIE_SAMESITE"`
+	CORSAllowedOrigins []string      `mapstructure:"CORS_ALLOWED_ORIGINS"`
+
+	StorageDriver    string `mapstructure:"STORAGE_DRIVER"`
+	StorageDir       string `mapstructure:"STORAGE_DIR"`
+	StorageURLSecret string `mapstructure:"STORAGE_URL_SECRET"`
+
+	S3Endpoint        string `mapstructure:"S3_ENDPOINT"`
+	S3Region          string `mapstructure:"S3_REGION"`
+	S3Bucket          string `mapstructure:"S3_BUCKET"`
+	S3AccessKeyID     string `mapstructure:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey string `mapstructure:"S3_SECRET_ACCESS_KEY"`
+	S3PathStyle       bool   `mapstructure:"S3_PATH_STYLE"`
+
+	AttachmentMaxSize      int           `mapstructure:"ATTACHMENT_MAX_SIZE"`
+	AttachmentTypes        []string      `mapstructure:"ATTACHMENT_TYPES"`
+	AttachmentURLExpiresIn time.Duration `mapstructure:"ATTACHMENT_URL_EXPIRED_IN"`
+}
+
+// OIDCProvider is an OpenID Connect provider users can log in with. Each name
+// listed in OIDC_PROVIDERS reads OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_SCOPES.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 func LoadConfig() (config Config, err error) {
@@ -49,5 +102,147 @@ func LoadConfig() (config Config, err error) {
 	config.SMTPPort, err = strconv.Atoi(os.Getenv("SMTP_PORT"))
 	config.SMTPUser = os.Getenv("SMTP_USER")
 
+	config.TrashRetention = getDuration("TRASH_RETENTION", 30*24*time.Hour)
+	config.PurgeInterval = getDuration("PURGE_INTERVAL", time.Hour)
+
+	config.ExportDir = getString("EXPORT_DIR", "exports")
+	config.ExportRetention = getDuration("EXPORT_RETENTION", 7*24*time.Hour)
+
+	config.AccountDeletionGrace = getDuration("ACCOUNT_DELETION_GRACE", 14*24*time.Hour)
+
+	config.PasswordMinLength = getInt("PASSWORD_MIN_LENGTH", 8)
+	config.PasswordMaxLength = getInt("PASSWORD_MAX_LENGTH", 72)
+	config.PasswordMinClasses = getInt("PASSWORD_MIN_CLASSES", 2)
+	config.PasswordMinScore = getInt("PASSWORD_MIN_SCORE", 2)
+	config.PasswordCheckBreached = getBool("PASSWORD_CHECK_BREACHED", true)
+	config.BreachedPasswordsFile = os.Getenv("BREACHED_PASSWORDS_FILE")
+
+	config.OIDCProviders = getOIDCProviders()
+
+	config.OAuthRefreshTokenExpiresIn = getDuration("OAUTH_REFRESH_TOKEN_EXPIRED_IN", 30*24*time.Hour)
+
+	config.MagicLinkExpiresIn = getDuration("MAGIC_LINK_EXPIRED_IN", 15*time.Minute)
+
+	config.CookieSecure = getBool("COOKIE_SECURE", strings.HasPrefix(config.BaseUrl, "https://"))
+	config.CookieSameSite = getSameSite("COOKIE_SAMESITE", http.SameSiteLaxMode)
+	// Browsers drop SameSite=None cookies that aren't secure
+	if config.CookieSameSite == http.SameSiteNoneMode {
+		config.CookieSecure = true
+	}
+	// The API's own origin is allowed unless others are listed
+	config.CORSAllowedOrigins = getList("CORS_ALLOWED_ORIGINS", nil)
+	if len(config.CORSAllowedOrigins) == 0 && config.BaseUrl != "" {
+		config.CORSAllowedOrigins = []string{strings.TrimSuffix(config.BaseUrl, "/")}
+	}
+
+	config.StorageDriver = strings.ToLower(getString("STORAGE_DRIVER", "local"))
+	config.StorageDir = getString("STORAGE_DIR", "attachments")
+	config.StorageURLSecret = os.Getenv("STORAGE_URL_SECRET")
+
+	// Without an endpoint the bucket is on AWS, elsewhere such as MinIO it is
+	// usually addressed by path
+	config.S3Endpoint = strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/")
+	config.S3Region = getString("S3_REGION", "us-east-1")
+	config.S3Bucket = os.Getenv("S3_BUCKET")
+	config.S3AccessKeyID = os.Getenv("S3_ACCESS_KEY_ID")
+	config.S3SecretAccessKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+	config.S3PathStyle = getBool("S3_PATH_STYLE", config.S3Endpoint != "")
+	if config.S3Endpoint == "" {
+		config.S3Endpoint = "https://s3." + config.S3Region + ".amazonaws.com"
+	}
+
+	config.AttachmentMaxSize = getInt("ATTACHMENT_MAX_SIZE", 10<<20)
+	config.AttachmentTypes = getList("ATTACHMENT_TYPES", []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf"})
+	config.AttachmentURLExpiresIn = getDuration("ATTACHMENT_URL_EXPIRED_IN", 15*time.Minute)
+
 	return
 }
+
+// getOIDCProviders reads the configured providers, skipping the ones missing an
+// issuer or a client id
+func getOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			Scopes:       strings.Fields(getString(prefix+"SCOPES", "openid email profile")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// getSameSite reads an optional SameSite cookie attribute: strict, lax or none
+func getSameSite(key string, fallback http.SameSite) http.SameSite {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return fallback
+}
+
+// getList reads an optional comma separated list, falling back when it is unset
+func getList(key string, fallback []string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return fallback
+	}
+	return values
+}
+
+// getDuration reads an optional duration, falling back when it is unset or invalid
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// getString reads an optional setting, falling back when it is unset
+func getString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// getInt reads an optional non-negative number, falling back when it is unset or
+// invalid
+func getInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// getBool reads an optional flag, falling back when it is unset or invalid
+func getBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccessTokenController struct {
+	accessTokenService services.AccessTokenService
+}
+
+func NewAccessTokenController(accessTokenService services.AccessTokenService) AccessTokenController {
+	return AccessTokenController{accessTokenService}
+}
+
+func (ac *AccessTokenController) List(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	tokens, err := ac.accessTokenService.All(currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", tokens)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Insert creates a token. The response is the only time the token is shown.
+func (ac *AccessTokenController) Insert(ctx *gin.Context) {
+	var input models.AccessTokenInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	created, err := ac.accessTokenService.Create(currentUser.ID, input)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidExpiry) {
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", created)
+	ctx.JSON(http.StatusCreated, response)
+}
+
+func (ac *AccessTokenController) Delete(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := ac.accessTokenService.Revoke(id, currentUser.ID); err != nil {
+		if errors.Is(err, services.ErrAccessTokenNotFound) {
+			res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+			ctx.JSON(http.StatusNotFound, res)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
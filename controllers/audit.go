@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"log"
+
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audit records an event of the request in the audit log, done by the current
+// user unless the entry names its actor. The event already happened, so failing
+// to record it is only logged.
+func audit(ctx *gin.Context, auditService services.AuditService, entry models.AuditLog, before interface{}, after interface{}) {
+	if value, ok := ctx.Get("currentUser"); ok && entry.ActorID == nil {
+		actorID := value.(*models.User).ID
+		entry.ActorID = &actorID
+	}
+	entry.IP = ctx.ClientIP()
+	entry.UserAgent = ctx.Request.UserAgent()
+
+	if err := auditService.Record(entry, before, after); err != nil {
+		log.Println("Could not record audit event", entry.Action, err)
+	}
+}
+
+// auditUser is an entry about the account of a user, done by them
+func auditUser(action string, userID int) models.AuditLog {
+	return models.AuditLog{ActorID: &userID, Action: action, TargetType: models.AuditTargetUser, TargetID: &userID}
+}
+
+// auditAnonymous is an entry about the account of a user, done by someone who
+// isn't logged in, such as a failed login
+func auditAnonymous(action string, userID int) models.AuditLog {
+	return models.AuditLog{Action: action, TargetType: models.AuditTargetUser, TargetID: &userID}
+}
+
+// auditTarget is an entry about a todo, a color or another target, done by the
+// current user
+func auditTarget(action string, targetType string, targetID int) models.AuditLog {
+	return models.AuditLog{Action: action, TargetType: targetType, TargetID: &targetID}
+}
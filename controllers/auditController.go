@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"net/http"
+
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	auditService services.AuditService
+}
+
+func NewAuditController(auditService services.AuditService) AuditController {
+	return AuditController{auditService}
+}
+
+// List returns the events the current user did or that targeted their account
+func (ac *AuditController) List(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	ac.list(ctx, &currentUser.ID)
+}
+
+// Export streams the events of List as JSON lines
+func (ac *AuditController) Export(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	ac.export(ctx, &currentUser.ID)
+}
+
+// AdminList returns the events of every user
+func (ac *AuditController) AdminList(ctx *gin.Context) {
+	ac.list(ctx, nil)
+}
+
+// AdminExport streams the events of every user as JSON lines
+func (ac *AuditController) AdminExport(ctx *gin.Context) {
+	ac.export(ctx, nil)
+}
+
+func (ac *AuditController) list(ctx *gin.Context, userID *int) {
+	var filter models.AuditLogFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	entries, err := ac.auditService.Find(filter, userID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", entries)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (ac *AuditController) export(ctx *gin.Context, userID *int) {
+	var filter models.AuditLogFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("Content-Disposition", `attachment; filename="audit-log.jsonl"`)
+	ctx.Status(http.StatusOK)
+	// The status is sent with the first line, a failure can only cut the
+	// stream short
+	if err := ac.auditService.Export(ctx.Writer, filter, userID); err != nil {
+		ctx.Error(err)
+	}
+}
@@ -1,12 +1,16 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/mail"
+	"net/url"
 	"strings"
+	"time"
 
 	"golang/config"
 	"golang/helper"
@@ -20,14 +24,15 @@ import (
 )
 
 type AuthController struct {
-	authService services.AuthService
-	userService services.UserService
-	ctx         context.Context
-	db          *gorm.DB
+	authService  services.AuthService
+	userService  services.UserService
+	auditService services.AuditService
+	ctx          context.Context
+	db           *gorm.DB
 }
 
-func NewAuthController(authService services.AuthService, userService services.UserService, ctx context.Context, db *gorm.DB) AuthController {
-	return AuthController{authService, userService, ctx, db}
+func NewAuthController(authService services.AuthService, userService services.UserService, auditService services.AuditService, ctx context.Context, db *gorm.DB) AuthController {
+	return AuthController{authService, userService, auditService, ctx, db}
 }
 
 func (ac *AuthController) SignUpUser(ctx *gin.Context) {
@@ -45,6 +50,11 @@ func (ac *AuthController) SignUpUser(ctx *gin.Context) {
 		return
 	}
 
+	if err := utils.CheckPassword(user.Password, user.Name, user.Email); err != nil {
+		abortWeakPassword(ctx, err)
+		return
+	}
+
 	// Generate Verification Code
 	code := randstr.String(20)
 	user.VerificationCode = utils.Encode(code)
@@ -60,6 +70,7 @@ func (ac *AuthController) SignUpUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadGateway, response)
 		return
 	}
+	audit(ctx, ac.auditService, auditUser(models.AuditSignUp, newUser.ID), nil, nil)
 
 	config, err := config.LoadConfig()
 	if err != nil {
@@ -177,31 +188,163 @@ func (ac *AuthController) SignInUser(ctx *gin.Context) {
 	}
 
 	if err := utils.VerifyPassword(user.Password, credentials.Password); err != nil {
+		audit(ctx, ac.auditService, auditAnonymous(models.AuditLoginFailed, user.ID), nil, nil)
 		response := helper.BuildErrorResponse("invalid email or Password", err.Error(), helper.EmptyObj{})
 		ctx.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	config, _ := config.LoadConfig()
+	// Logging in during the grace period keeps the account
+	if user.DeletionScheduledAt != nil {
+		if err := ac.userService.CancelDeletion(user.ID); err != nil {
+			response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadGateway, response)
+			return
+		}
+	}
 
-	// Generate Tokens
-	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, config.AccessTokenPrivateKey)
+	access_token, err := startSession(ctx, user.ID)
 	if err != nil {
 		response := helper.BuildErrorResponse("error create access token", err.Error(), helper.EmptyObj{})
 		ctx.JSON(http.StatusBadRequest, response)
 		return
 	}
+	audit(ctx, ac.auditService, auditUser(models.AuditLogin, user.ID), nil, nil)
 
-	refresh_token, err := utils.CreateToken(config.RefreshTokenExpiresIn, user.ID, config.RefreshTokenPrivateKey)
-	if err != nil {
-		response := helper.BuildErrorResponse("error create refresh token", err.Error(), helper.EmptyObj{})
+	result := make(map[string]string)
+	result["access_token"] = access_token
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// magicLinkDeviceCookie holds the secret binding a login link to the browser
+// that asked for it
+const magicLinkDeviceCookie = "magic_link_device"
+
+// RequestMagicLink emails a one-time login link. The answer is the same whether
+// or not the email belongs to an account.
+func (ac *AuthController) RequestMagicLink(ctx *gin.Context) {
+	var input *models.MagicLinkInput
+
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if _, err := mail.ParseAddress(input.Email); err != nil {
+		response := helper.BuildErrorResponse("email is invalid", err.Error(), helper.EmptyObj{})
 		ctx.JSON(http.StatusBadRequest, response)
 		return
 	}
 
-	ctx.SetCookie("access_token", access_token, config.AccessTokenMaxAge*60, "/", config.Domain, false, true)
-	ctx.SetCookie("refresh_token", refresh_token, config.RefreshTokenMaxAge*60, "/", config.Domain, false, true)
-	ctx.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", config.Domain, false, false)
+	message := "You will receive a login link if user with that email exist"
+	user, err := ac.userService.FindUserByEmail(input.Email)
+	if err != nil || !user.Verified {
+		response := helper.BuildResponse(message, helper.EmptyObj{})
+		ctx.JSON(http.StatusOK, response)
+		return
+	}
+
+	config, _ := config.LoadConfig()
+
+	token, deviceSecret, err := ac.authService.CreateMagicLink(user.ID, input.SameDevice, config.MagicLinkExpiresIn)
+	if err != nil {
+		response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, ac.auditService, auditAnonymous(models.AuditMagicLinkRequested, user.ID), nil, nil)
+	if deviceSecret != "" {
+		setCookie(ctx, magicLinkDeviceCookie, deviceSecret, int(config.MagicLinkExpiresIn.Seconds()), "/api/auth/magiclink", true)
+	}
+
+	// 👇 Send Email
+	emailData := utils.EmailData{
+		URL:       config.BaseUrl + "/api/auth/magiclink/" + token,
+		FirstName: user.Name,
+		Subject:   "Your login link",
+		When:      utils.FormatTime(time.Now().Add(config.MagicLinkExpiresIn), user.Preferences),
+	}
+
+	err = utils.SendEmail(user, &emailData, "magicLink.html")
+	if err != nil {
+		response := helper.BuildErrorResponse("there was an error sending email", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse(message, helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+type magicLinkPage struct {
+	Subject string
+	Action  string
+}
+
+// MagicLinkPage is where the link of the email lands. It only shows a button
+// posting the token to MagicLogin, so mail scanners following the link don't
+// use it up.
+func (ac *AuthController) MagicLinkPage(ctx *gin.Context) {
+	config, _ := config.LoadConfig()
+	var body bytes.Buffer
+	err := utils.RenderPage(&body, "magicLinkLogin.html", magicLinkPage{
+		Subject: "Log in",
+		Action:  config.BaseUrl + "/api/auth/magiclink/" + url.PathEscape(ctx.Param("token")),
+	})
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	ctx.Header("X-Frame-Options", "DENY")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Referrer-Policy", "no-referrer")
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", body.Bytes())
+}
+
+// MagicLogin logs in with a link from RequestMagicLink, like SignInUser does
+// with a password
+func (ac *AuthController) MagicLogin(ctx *gin.Context) {
+	deviceSecret, _ := ctx.Cookie(magicLinkDeviceCookie)
+
+	user, err := ac.authService.RedeemMagicLink(ctx.Params.ByName("token"), deviceSecret)
+	if err != nil {
+		if errors.Is(err, services.ErrMagicLinkNotFound) {
+			response := helper.BuildErrorResponse("error find data", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		if errors.Is(err, services.ErrMagicLinkOtherDevice) {
+			response := helper.BuildErrorResponse("open the link on the device you asked for it", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusForbidden, response)
+			return
+		}
+		response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadGateway, response)
+		return
+	}
+
+	setCookie(ctx, magicLinkDeviceCookie, "", -1, "/api/auth/magiclink", true)
+
+	// Logging in during the grace period keeps the account
+	if user.DeletionScheduledAt != nil {
+		if err := ac.userService.CancelDeletion(user.ID); err != nil {
+			response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadGateway, response)
+			return
+		}
+	}
+
+	access_token, err := startSession(ctx, user.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("error create access token", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	audit(ctx, ac.auditService, auditUser(models.AuditMagicLinkLogin, user.ID), nil, nil)
 
 	result := make(map[string]string)
 	result["access_token"] = access_token
@@ -219,43 +362,54 @@ func (ac *AuthController) RefreshAccessToken(ctx *gin.Context) {
 
 	config, _ := config.LoadConfig()
 
-	sub, err := utils.ValidateToken(cookie, config.RefreshTokenPublicKey)
+	claims, err := utils.ParseToken(cookie, utils.RefreshTokenKeys)
 	if err != nil {
 		response := helper.BuildErrorResponse("error validate token", err.Error(), helper.EmptyObj{})
 		ctx.AbortWithStatusJSON(http.StatusForbidden, response)
 		return
 	}
 
-	user, err := ac.userService.FindUserById(fmt.Sprint(sub))
+	user, err := ac.userService.FindUserById(fmt.Sprint(claims["sub"]))
 	if err != nil {
 		response := helper.BuildErrorResponse("the user belonging to this token no logger exists", err.Error(), helper.EmptyObj{})
 		ctx.AbortWithStatusJSON(http.StatusForbidden, response)
 		return
 	}
 
-	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, config.AccessTokenPrivateKey)
+	if user.DeletionScheduledAt != nil {
+		response := helper.BuildErrorResponse("the account is scheduled for deletion", "log in again to cancel the deletion", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusForbidden, response)
+		return
+	}
+
+	if user.SessionsValidAfter != nil && utils.IssuedBefore(claims, *user.SessionsValidAfter) {
+		response := helper.BuildErrorResponse("the session was revoked", "log in again", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusForbidden, response)
+		return
+	}
+
+	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, user.ID, utils.AccessTokenKeys)
 	if err != nil {
 		response := helper.BuildErrorResponse("error create token", err.Error(), helper.EmptyObj{})
 		ctx.AbortWithStatusJSON(http.StatusForbidden, response)
 		return
 	}
 
-	ctx.SetCookie("access_token", access_token, config.AccessTokenMaxAge*60, "/", config.Domain, false, true)
-	ctx.SetCookie("logged_in", "true", config.AccessTokenMaxAge*60, "/", config.Domain, false, false)
+	setCookie(ctx, "access_token", access_token, config.AccessTokenMaxAge*60, "/", true)
+	setCookie(ctx, "logged_in", "true", config.AccessTokenMaxAge*60, "/", false)
+	// Sessions started before CSRF tokens existed get one on their next refresh
+	if csrf, err := ctx.Cookie("csrf_token"); err != nil || csrf == "" {
+		setCSRFCookie(ctx, randstr.String(32))
+	}
 
 	response := helper.BuildResponse("OK", access_token)
 	ctx.JSON(http.StatusOK, response)
 }
 
 func (ac *AuthController) LogoutUser(ctx *gin.Context) {
-	config, err := config.LoadConfig()
-	if err != nil {
-		log.Fatal("Could not load config", err)
-	}
-
-	ctx.SetCookie("access_token", "", -1, "/", config.Domain, false, true)
-	ctx.SetCookie("refresh_token", "", -1, "/", config.Domain, false, true)
-	ctx.SetCookie("logged_in", "", -1, "/", config.Domain, false, true)
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	endSession(ctx)
+	audit(ctx, ac.auditService, auditUser(models.AuditLogout, currentUser.ID), nil, nil)
 
 	response := helper.BuildResponse("OK", helper.EmptyObj{})
 	ctx.JSON(http.StatusOK, response)
@@ -280,6 +434,7 @@ func (ac *AuthController) VerifyEmail(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadGateway, response)
 		return
 	}
+	audit(ctx, ac.auditService, auditUser(models.AuditEmailVerified, user.ID), nil, nil)
 
 	response := helper.BuildResponse("Email verified successfully", helper.EmptyObj{})
 	ctx.JSON(http.StatusOK, response)
@@ -324,6 +479,7 @@ func (ac *AuthController) ForgotPassword(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadGateway, response)
 		return
 	}
+	audit(ctx, ac.auditService, auditAnonymous(models.AuditPasswordResetRequested, user.ID), nil, nil)
 	var firstName = user.Name
 
 	if strings.Contains(firstName, " ") {
@@ -379,6 +535,7 @@ func (ac *AuthController) ResendForgotPassword(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadGateway, response)
 		return
 	}
+	audit(ctx, ac.auditService, auditAnonymous(models.AuditPasswordResetRequested, user.ID), nil, nil)
 
 	config, _ := config.LoadConfig()
 
@@ -390,7 +547,7 @@ func (ac *AuthController) ResendForgotPassword(ctx *gin.Context) {
 		Subject:   "Your password reset token",
 	}
 
-	err = utils.SendEmail(user, &emailData, "verificationCode.html")
+	err = utils.SendEmail(user, &emailData, "resetPassword.html")
 	if err != nil {
 		response := helper.BuildErrorResponse("there was an error sending email", err.Error(), helper.EmptyObj{})
 		ctx.JSON(http.StatusBadGateway, response)
@@ -412,7 +569,6 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
-	hashedPassword, _ := utils.HashPassword(userCredential.Password)
 	passwordResetToken := utils.Encode(resetToken)
 
 	var user *models.User
@@ -423,23 +579,65 @@ func (ac *AuthController) ResetPassword(ctx *gin.Context) {
 		return
 	}
 
+	if err := utils.CheckPassword(userCredential.Password, user.Name, user.Email); err != nil {
+		abortWeakPassword(ctx, err)
+		return
+	}
+	hashedPassword, _ := utils.HashPassword(userCredential.Password)
+
+	// A reset logs out every session, the password may have leaked
+	validAfter := time.Now().Truncate(time.Second)
 	user.Password = hashedPassword
 	user.PasswordResetToken = ""
+	user.SessionsValidAfter = &validAfter
 	if err := ac.db.Save(&user).Error; err != nil {
 		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
 		ctx.JSON(http.StatusBadGateway, response)
 		return
 	}
+	audit(ctx, ac.auditService, auditUser(models.AuditPasswordReset, user.ID), nil, nil)
 
-	config, err := config.LoadConfig()
+	endSession(ctx)
+
+	response := helper.BuildResponse("Password data updated successfully", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (ac *AuthController) ConfirmEmail(ctx *gin.Context) {
+	user, err := ac.userService.ConfirmEmailChange(ctx.Params.ByName("token"))
 	if err != nil {
-		log.Fatal("Could not load config", err)
+		ac.emailChangeError(ctx, err)
+		return
 	}
+	audit(ctx, ac.auditService, auditUser(models.AuditEmailChanged, user.ID), nil, nil)
 
-	ctx.SetCookie("access_token", "", -1, "/", config.Domain, false, true)
-	ctx.SetCookie("refresh_token", "", -1, "/", config.Domain, false, true)
-	ctx.SetCookie("logged_in", "", -1, "/", config.Domain, false, true)
+	response := helper.BuildResponse("Email changed successfully", models.FilteredResponse(user))
+	ctx.JSON(http.StatusOK, response)
+}
 
-	response := helper.BuildResponse("Password data updated successfully", helper.EmptyObj{})
+func (ac *AuthController) RevertEmail(ctx *gin.Context) {
+	user, err := ac.userService.RevertEmailChange(ctx.Params.ByName("token"))
+	if err != nil {
+		ac.emailChangeError(ctx, err)
+		return
+	}
+	audit(ctx, ac.auditService, auditUser(models.AuditEmailReverted, user.ID), nil, nil)
+
+	response := helper.BuildResponse("Email change reverted successfully", models.FilteredResponse(user))
 	ctx.JSON(http.StatusOK, response)
 }
+
+func (ac *AuthController) emailChangeError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrEmailChangeNotFound) {
+		response := helper.BuildErrorResponse("error find data", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if strings.Contains(err.Error(), "duplicate key value") {
+		response := helper.BuildErrorResponse("name or email already exist", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusConflict, response)
+		return
+	}
+	response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+	ctx.JSON(http.StatusBadGateway, response)
+}
@@ -13,10 +13,11 @@ import (
 
 type ColorController struct {
 	colorService services.ColorService
+	auditService services.AuditService
 }
 
-func NewColorController(colorService services.ColorService) ColorController {
-	return ColorController{colorService}
+func NewColorController(colorService services.ColorService, auditService services.AuditService) ColorController {
+	return ColorController{colorService, auditService}
 }
 
 func (cc *ColorController) List(ctx *gin.Context) {
@@ -72,6 +73,8 @@ func (cc *ColorController) Insert(ctx *gin.Context) {
 			ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
 			return
 		}
+		audit(ctx, cc.auditService, auditTarget(models.AuditColorCreate, models.AuditTargetColor, result.ID), nil, result)
+
 		response := helper.BuildResponse("OK", result)
 		ctx.JSON(http.StatusCreated, response)
 		return
@@ -113,6 +116,8 @@ func (cc *ColorController) Update(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
 		return
 	}
+	audit(ctx, cc.auditService, auditTarget(models.AuditColorUpdate, models.AuditTargetColor, id), color, result)
+
 	response := helper.BuildResponse("OK", result)
 	ctx.JSON(http.StatusOK, response)
 	return
@@ -146,6 +151,7 @@ func (cc *ColorController) Delete(ctx *gin.Context) {
 		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
 		return
 	}
+	audit(ctx, cc.auditService, auditTarget(models.AuditColorDelete, models.AuditTargetColor, id), color, nil)
 
 	response := helper.BuildResponse("Deleted", helper.EmptyObj{})
 	ctx.JSON(http.StatusOK, response)
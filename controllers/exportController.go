@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportController struct {
+	exportService services.ExportService
+}
+
+func NewExportController(exportService services.ExportService) ExportController {
+	return ExportController{exportService}
+}
+
+// Create starts building an archive of the user's data. The download link is
+// emailed once it's ready.
+func (ec *ExportController) Create(ctx *gin.Context) {
+	var input models.ExportInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	export, err := ec.exportService.Create(currentUser.ID, input)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", export)
+	ctx.JSON(http.StatusAccepted, response)
+}
+
+func (ec *ExportController) FindByID(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	export, err := ec.exportService.FindByID(id, currentUser.ID)
+	if err != nil {
+		res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	response := helper.BuildResponse("OK", export)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Download streams the archive a download link points to. It is public, the token
+// in the link is the credential.
+func (ec *ExportController) Download(ctx *gin.Context) {
+	export, err := ec.exportService.FindByToken(ctx.Param("token"))
+	if err != nil {
+		res := helper.BuildErrorResponse("Data not found", "The download link is invalid or expired", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	ctx.FileAttachment(export.Path, "export-"+export.CreatedAt.Format("2006-01-02")+".zip")
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+
+	"golang/config"
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FeedController struct {
+	feedService services.FeedService
+}
+
+func NewFeedController(feedService services.FeedService) FeedController {
+	return FeedController{feedService}
+}
+
+// Regenerate issues a new feed URL and revokes the previous one
+func (fc *FeedController) Regenerate(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	token, err := fc.feedService.RegenerateToken(currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Println("Could not load config", err)
+		response := helper.BuildErrorResponse("Failed to process request", "could not load config", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", gin.H{"url": config.BaseUrl + "/api/feed/" + token + "/todos.ics"})
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (fc *FeedController) Disable(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := fc.feedService.Disable(currentUser.ID); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Calendar serves the iCalendar feed. It is public, the token in the URL is the credential.
+func (fc *FeedController) Calendar(ctx *gin.Context) {
+	token := ctx.Param("token")
+	if token == "" {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	user, err := fc.feedService.FindUserByToken(token)
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+
+	body, err := fc.feedService.Calendar(user.ID, ctx.Query("type") == "event")
+	if err != nil {
+		ctx.AbortWithStatus(http.StatusBadGateway)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(body))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	ctx.Header("ETag", etag)
+	ctx.Header("Cache-Control", "private, max-age=300")
+	if ctx.GetHeader("If-None-Match") == etag {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+
+	ctx.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(body))
+}
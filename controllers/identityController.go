@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie ties a login with a provider to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+type IdentityController struct {
+	identityService services.IdentityService
+	userService     services.UserService
+}
+
+func NewIdentityController(identityService services.IdentityService, userService services.UserService) IdentityController {
+	return IdentityController{identityService, userService}
+}
+
+func (ic *IdentityController) Providers(ctx *gin.Context) {
+	response := helper.BuildResponse("OK", ic.identityService.Providers())
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Login sends the user to the provider
+func (ic *IdentityController) Login(ctx *gin.Context) {
+	url, ok := ic.start(ctx, nil)
+	if !ok {
+		return
+	}
+	ctx.Redirect(http.StatusFound, url)
+}
+
+// Link starts linking a provider to the current user. The client sends the
+// user to the returned URL, the provider then comes back to the callback.
+func (ic *IdentityController) Link(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	url, ok := ic.start(ctx, &currentUser.ID)
+	if !ok {
+		return
+	}
+
+	response := helper.BuildResponse("OK", gin.H{"url": url})
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (ic *IdentityController) start(ctx *gin.Context, userID *int) (string, bool) {
+	url, state, err := ic.identityService.StartLogin(ctx.Param("provider"), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownProvider) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.AbortWithStatusJSON(http.StatusNotFound, response)
+			return "", false
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return "", false
+	}
+
+	setRedirectCookie(ctx, oidcStateCookie, utils.HashToken(state), 10*60, "/api/auth/oidc")
+	return url, true
+}
+
+// Callback finishes a login or a linking when the provider sends the user back
+func (ic *IdentityController) Callback(ctx *gin.Context) {
+	if reason := ctx.Query("error"); reason != "" {
+		response := helper.BuildErrorResponse("login with provider failed", reason+" "+ctx.Query("error_description"), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	state := ctx.Query("state")
+	cookie, err := ctx.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie != utils.HashToken(state) {
+		response := helper.BuildErrorResponse("login with provider failed", "the login was started from another browser", helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	setRedirectCookie(ctx, oidcStateCookie, "", -1, "/api/auth/oidc")
+
+	user, err := ic.identityService.FinishLogin(ctx.Param("provider"), state, ctx.Query("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownProvider):
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusNotFound, response)
+		case errors.Is(err, services.ErrOIDCLoginNotFound), errors.Is(err, services.ErrEmailNotVerified), errors.Is(err, utils.ErrInvalidIDToken):
+			response := helper.BuildErrorResponse("login with provider failed", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+		case errors.Is(err, services.ErrIdentityTaken), errors.Is(err, services.ErrProviderLinked):
+			response := helper.BuildErrorResponse("login with provider failed", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusConflict, response)
+		default:
+			response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadGateway, response)
+		}
+		return
+	}
+
+	// Logging in during the grace period keeps the account
+	if user.DeletionScheduledAt != nil {
+		if err := ic.userService.CancelDeletion(user.ID); err != nil {
+			response := helper.BuildErrorResponse("failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadGateway, response)
+			return
+		}
+	}
+
+	access_token, err := startSession(ctx, user.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("error create access token", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	result := make(map[string]string)
+	result["access_token"] = access_token
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (ic *IdentityController) List(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	identities, err := ic.identityService.All(currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", identities)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (ic *IdentityController) Unlink(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	err := ic.identityService.Unlink(currentUser.ID, ctx.Param("provider"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIdentityNotFound):
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusNotFound, response)
+		case errors.Is(err, services.ErrLastLoginMethod):
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusConflict, response)
+		default:
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadGateway, response)
+		}
+		return
+	}
+
+	response := helper.BuildResponse("Deleted", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"net/http"
+
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeyController struct{}
+
+func NewKeyController() KeyController {
+	return KeyController{}
+}
+
+// JWKS publishes the public keys access tokens are signed with, so other
+// services can verify them. Refresh tokens are only read by this API and their
+// keys stay private.
+func (kc *KeyController) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, gin.H{"keys": utils.AccessTokenKeys.JWKS()})
+}
@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang/config"
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thanhpk/randstr"
+)
+
+// oauthConsentCookie ties the consent form to the browser it was shown in, so
+// other sites can't post it on the user's behalf
+const oauthConsentCookie = "oauth_consent"
+
+type OAuthController struct {
+	oauthService services.OAuthService
+}
+
+func NewOAuthController(oauthService services.OAuthService) OAuthController {
+	return OAuthController{oauthService}
+}
+
+type consentPage struct {
+	models.OAuthAuthorizeInput
+	Subject    string
+	FirstName  string
+	ClientName string
+	Scopes     []string
+	Action     string
+	Consent    string
+	CSRFToken  string
+}
+
+// Authorize shows the consent page of an authorization request
+func (oc *OAuthController) Authorize(ctx *gin.Context) {
+	var input models.OAuthAuthorizeInput
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	client, scopes, ok := oc.validateAuthorize(ctx, input)
+	if !ok {
+		return
+	}
+
+	config, _ := config.LoadConfig()
+	consent := randstr.String(32)
+	setCookie(ctx, oauthConsentCookie, consent, 10*60, "/api/oauth", true)
+
+	descriptions := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		descriptions = append(descriptions, models.OAuthScopeDescriptions[scope])
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	csrfToken, _ := ctx.Cookie("csrf_token")
+	var body bytes.Buffer
+	err := utils.RenderPage(&body, "oauthConsent.html", consentPage{
+		OAuthAuthorizeInput: input,
+		Subject:             "Authorize " + client.Name,
+		FirstName:           currentUser.Name,
+		ClientName:          client.Name,
+		Scopes:              descriptions,
+		Action:              config.BaseUrl + "/api/oauth/authorize",
+		Consent:             consent,
+		CSRFToken:           csrfToken,
+	})
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusInternalServerError, response)
+		return
+	}
+
+	ctx.Header("X-Frame-Options", "DENY")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", body.Bytes())
+}
+
+// Consent sends the user back to the client, with an authorization code when
+// they allowed the access
+func (oc *OAuthController) Consent(ctx *gin.Context) {
+	var input models.OAuthConsentInput
+	if err := ctx.ShouldBind(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	cookie, err := ctx.Cookie(oauthConsentCookie)
+	if err != nil || cookie != input.Consent {
+		response := helper.BuildErrorResponse("Failed to process request", "the consent form expired, start again", helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	setCookie(ctx, oauthConsentCookie, "", -1, "/api/oauth", true)
+
+	client, scopes, ok := oc.validateAuthorize(ctx, input.OAuthAuthorizeInput)
+	if !ok {
+		return
+	}
+	if input.Decision != "allow" {
+		redirectOAuthError(ctx, input.OAuthAuthorizeInput, "access_denied", "the user denied the access")
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	code, err := oc.oauthService.Authorize(client, currentUser.ID, input.RedirectURI, scopes, input.CodeChallenge)
+	if err != nil {
+		redirectOAuthError(ctx, input.OAuthAuthorizeInput, "server_error", "")
+		return
+	}
+
+	params := url.Values{"code": {code}}
+	if input.State != "" {
+		params.Set("state", input.State)
+	}
+	ctx.Redirect(http.StatusFound, withQuery(input.RedirectURI, params))
+}
+
+// validateAuthorize checks an authorization request. Until the client and its
+// redirect URI are known, errors are shown to the user instead of being sent
+// to the client.
+func (oc *OAuthController) validateAuthorize(ctx *gin.Context, input models.OAuthAuthorizeInput) (*models.OAuthClient, models.Scopes, bool) {
+	client, err := oc.oauthService.FindClient(input.ClientID)
+	if err != nil || !client.AllowsRedirect(input.RedirectURI) {
+		response := helper.BuildErrorResponse("Failed to process request", "unknown client_id or redirect_uri", helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return nil, nil, false
+	}
+
+	if input.ResponseType != "code" {
+		redirectOAuthError(ctx, input, "unsupported_response_type", "only the code response type is supported")
+		return nil, nil, false
+	}
+	if input.CodeChallenge == "" || input.CodeChallengeMethod != "S256" {
+		redirectOAuthError(ctx, input, "invalid_request", "PKCE with the S256 method is required")
+		return nil, nil, false
+	}
+	scopes, err := services.ParseOAuthScopes(input.Scope, client.Scopes)
+	if err != nil {
+		redirectOAuthError(ctx, input, "invalid_scope", err.Error())
+		return nil, nil, false
+	}
+	return client, scopes, true
+}
+
+// Token exchanges an authorization code or a refresh token for tokens
+func (oc *OAuthController) Token(ctx *gin.Context) {
+	var input models.OAuthTokenInput
+	if err := ctx.ShouldBind(&input); err != nil {
+		abortOAuth(ctx, services.ErrInvalidRequest, err.Error())
+		return
+	}
+
+	client, ok := oc.authenticate(ctx, input.ClientID, input.ClientSecret)
+	if !ok {
+		return
+	}
+
+	var (
+		tokens models.OAuthTokenResponse
+		err    error
+	)
+	switch input.GrantType {
+	case "authorization_code":
+		tokens, err = oc.oauthService.ExchangeCode(client, input.Code, input.RedirectURI, input.CodeVerifier)
+	case "refresh_token":
+		tokens, err = oc.oauthService.Refresh(client, input.RefreshToken, input.Scope)
+	default:
+		abortOAuth(ctx, &services.OAuthError{Code: "unsupported_grant_type"}, input.GrantType+" is not supported")
+		return
+	}
+	if err != nil {
+		abortOAuth(ctx, err, "")
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, tokens)
+}
+
+// Introspect tells a client whether one of its tokens is active
+func (oc *OAuthController) Introspect(ctx *gin.Context) {
+	client, ok := oc.authenticate(ctx, ctx.PostForm("client_id"), ctx.PostForm("client_secret"))
+	if !ok {
+		return
+	}
+
+	introspection, err := oc.oauthService.Introspect(client, ctx.PostForm("token"))
+	if err != nil {
+		abortOAuth(ctx, err, "")
+		return
+	}
+	ctx.JSON(http.StatusOK, introspection)
+}
+
+// Revoke ends the access behind a token of the client
+func (oc *OAuthController) Revoke(ctx *gin.Context) {
+	client, ok := oc.authenticate(ctx, ctx.PostForm("client_id"), ctx.PostForm("client_secret"))
+	if !ok {
+		return
+	}
+
+	if err := oc.oauthService.Revoke(client, ctx.PostForm("token")); err != nil {
+		abortOAuth(ctx, err, "")
+		return
+	}
+	ctx.Status(http.StatusOK)
+}
+
+// authenticate reads the client credentials from basic auth, falling back to
+// the form
+func (oc *OAuthController) authenticate(ctx *gin.Context, clientID string, secret string) (*models.OAuthClient, bool) {
+	if id, password, ok := ctx.Request.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(password)
+	}
+
+	client, err := oc.oauthService.Authenticate(clientID, secret)
+	if err != nil {
+		abortOAuth(ctx, err, "")
+		return nil, false
+	}
+	return client, true
+}
+
+func (oc *OAuthController) Clients(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	clients, err := oc.oauthService.Clients(currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", clients)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CreateClient registers an app. The response is the only time its secret is shown.
+func (oc *OAuthController) CreateClient(ctx *gin.Context) {
+	var input models.OAuthClientInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	created, err := oc.oauthService.CreateClient(currentUser.ID, input)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", created)
+	ctx.JSON(http.StatusCreated, response)
+}
+
+func (oc *OAuthController) DeleteClient(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := oc.oauthService.DeleteClient(id, currentUser.ID); err != nil {
+		if errors.Is(err, services.ErrOAuthClientNotFound) {
+			res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+			ctx.JSON(http.StatusNotFound, res)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("Deleted", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Grants lists the apps the user gave access to
+func (oc *OAuthController) Grants(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	grants, err := oc.oauthService.Grants(currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", grants)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (oc *OAuthController) RevokeGrant(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := oc.oauthService.RevokeGrant(id, currentUser.ID); err != nil {
+		if errors.Is(err, services.ErrOAuthGrantNotFound) {
+			res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+			ctx.JSON(http.StatusNotFound, res)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("Revoked", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+// abortOAuth answers with an error body of RFC 6749 section 5.2, which clients
+// expect instead of the usual response shape
+func abortOAuth(ctx *gin.Context, err error, description string) {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	if description == "" {
+		description = strings.TrimPrefix(strings.TrimPrefix(err.Error(), oauthErr.Code), ": ")
+	}
+	status := http.StatusBadRequest
+	if oauthErr == services.ErrInvalidClient {
+		status = http.StatusUnauthorized
+		ctx.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+
+	body := gin.H{"error": oauthErr.Code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.AbortWithStatusJSON(status, body)
+}
+
+// redirectOAuthError sends an authorization error back to the client
+func redirectOAuthError(ctx *gin.Context, input models.OAuthAuthorizeInput, code string, description string) {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if input.State != "" {
+		params.Set("state", input.State)
+	}
+	ctx.Redirect(http.StatusFound, withQuery(input.RedirectURI, params))
+}
+
+func withQuery(uri string, params url.Values) string {
+	if strings.Contains(uri, "?") {
+		return uri + "&" + params.Encode()
+	}
+	return uri + "?" + params.Encode()
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"golang/helper"
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// abortWeakPassword answers a password that breaks the policy, with the codes of
+// the broken rules as data
+func abortWeakPassword(ctx *gin.Context, err error) {
+	var policyErr *utils.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		response := helper.BuildErrorResponse("Password does not meet the policy", err.Error(), policyErr.Violations)
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+	response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+	ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"net/http"
+
+	"golang/config"
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thanhpk/randstr"
+)
+
+// startSession logs the client in with a new pair of tokens set as cookies and
+// returns the access token
+func startSession(ctx *gin.Context, userID int) (string, error) {
+	config, _ := config.LoadConfig()
+
+	access_token, err := utils.CreateToken(config.AccessTokenExpiresIn, userID, utils.AccessTokenKeys)
+	if err != nil {
+		return "", err
+	}
+
+	refresh_token, err := utils.CreateToken(config.RefreshTokenExpiresIn, userID, utils.RefreshTokenKeys)
+	if err != nil {
+		return "", err
+	}
+
+	setCookie(ctx, "access_token", access_token, config.AccessTokenMaxAge*60, "/", true)
+	setCookie(ctx, "refresh_token", refresh_token, config.RefreshTokenMaxAge*60, "/", true)
+	setCookie(ctx, "logged_in", "true", config.AccessTokenMaxAge*60, "/", false)
+	setCSRFCookie(ctx, randstr.String(32))
+
+	return access_token, nil
+}
+
+// endSession clears the cookies of startSession
+func endSession(ctx *gin.Context) {
+	for _, name := range []string{"access_token", "refresh_token", "logged_in", "csrf_token"} {
+		setCookie(ctx, name, "", -1, "/", true)
+	}
+}
+
+// setCSRFCookie sets the token clients send back in the X-CSRF-Token header
+// with cookie-authenticated changes. Scripts of the app read it, so it's not
+// HttpOnly, and it lives as long as the refresh token.
+func setCSRFCookie(ctx *gin.Context, token string) {
+	config, _ := config.LoadConfig()
+	setCookie(ctx, "csrf_token", token, config.RefreshTokenMaxAge*60, "/", false)
+}
+
+// setCookie sets a cookie with the configured SameSite and Secure attributes
+func setCookie(ctx *gin.Context, name string, value string, maxAge int, path string, httpOnly bool) {
+	config, _ := config.LoadConfig()
+	ctx.SetSameSite(config.CookieSameSite)
+	ctx.SetCookie(name, value, maxAge, path, config.Domain, config.CookieSecure, httpOnly)
+}
+
+// setRedirectCookie sets a cookie that has to come back when another site
+// redirects the user here, which SameSite=Strict would prevent
+func setRedirectCookie(ctx *gin.Context, name string, value string, maxAge int, path string) {
+	config, _ := config.LoadConfig()
+	sameSite := config.CookieSameSite
+	if sameSite == http.SameSiteStrictMode {
+		sameSite = http.SameSiteLaxMode
+	}
+	ctx.SetSameSite(sameSite)
+	ctx.SetCookie(name, value, maxAge, path, config.Domain, config.CookieSecure, true)
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"golang/config"
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Attachments lists the files attached to a todo, with links to download them
+// that expire after a while
+func (tc *TodoController) Attachments(ctx *gin.Context) {
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	attachments, err := tc.attachmentService.All(id)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	response := helper.BuildResponse("OK", attachments)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// InsertAttachment attaches the uploaded file to a todo. Images get a thumbnail.
+func (tc *TodoController) InsertAttachment(ctx *gin.Context) {
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Println("Could not load config", err)
+		response := helper.BuildErrorResponse("Failed to process request", "could not load config", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	maxSize := int64(config.AttachmentMaxSize)
+	tooLarge := fmt.Sprintf("The file is larger than %g MB", float64(maxSize)/(1<<20))
+
+	id, ok := tc.allowedTodo(ctx, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	// The form around the file may take a little more than the file itself
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize+1<<20)
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+	if header.Size > maxSize {
+		response := helper.BuildErrorResponse("Failed to process request", tooLarge, helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, response)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+	if int64(len(content)) > maxSize {
+		response := helper.BuildErrorResponse("Failed to process request", tooLarge, helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	attachment, err := tc.attachmentService.Create(id, currentUser.ID, header.Filename, content)
+	if err != nil {
+		attachmentError(ctx, err)
+		return
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoAttach, models.AuditTargetTodo, id), nil, attachmentAudit(attachment))
+
+	response := helper.BuildResponse("OK", attachment)
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// DownloadAttachment redirects to a signed link to the file of an attachment
+func (tc *TodoController) DownloadAttachment(ctx *gin.Context) {
+	attachmentID, err := strconv.Atoi(ctx.Param("attachmentId"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param attachmentId was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	attachment, err := tc.attachmentService.FindByID(id, attachmentID)
+	if err != nil {
+		attachmentError(ctx, err)
+		return
+	}
+	ctx.Redirect(http.StatusFound, attachment.URL)
+}
+
+// DeleteAttachment removes an attachment of a todo along with its file
+func (tc *TodoController) DeleteAttachment(ctx *gin.Context) {
+	attachmentID, err := strconv.Atoi(ctx.Param("attachmentId"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param attachmentId was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	attachment, err := tc.attachmentService.Delete(id, attachmentID)
+	if err != nil {
+		attachmentError(ctx, err)
+		return
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoDetach, models.AuditTargetTodo, id), attachmentAudit(attachment), nil)
+
+	response := helper.BuildResponse("Deleted", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+// AttachmentBlob serves a file of the local storage. It is public, the signature
+// of the link is the credential.
+func (tc *TodoController) AttachmentBlob(ctx *gin.Context) {
+	blob, name, contentType, err := tc.attachmentService.OpenSigned(ctx.Request.URL.Query())
+	if err != nil {
+		res := helper.BuildErrorResponse("Data not found", utils.ErrInvalidSignedURL.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+	defer blob.Close()
+
+	ctx.DataFromReader(http.StatusOK, -1, contentType, blob, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": name}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// attachmentAudit is what the audit log keeps of an attachment, leaving out
+// its signed links
+func attachmentAudit(attachment models.TodoAttachment) gin.H {
+	return gin.H{"attachment": gin.H{
+		"id":          attachment.ID,
+		"name":        attachment.Name,
+		"contentType": attachment.ContentType,
+		"size":        attachment.Size,
+	}}
+}
+
+func attachmentError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAttachmentNotFound):
+		response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, response)
+	case errors.Is(err, services.ErrAttachmentType):
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusUnsupportedMediaType, response)
+	case errors.Is(err, utils.ErrUnsupportedImage):
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+	default:
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+	}
+}
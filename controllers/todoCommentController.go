@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"golang/config"
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Comments lists the discussion thread of a todo, oldest first
+func (tc *TodoController) Comments(ctx *gin.Context) {
+	var query models.TodoCommentQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	comments, err := tc.commentService.All(id, query)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	response := helper.BuildResponse("OK", comments)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// InsertComment adds a comment to a todo. Everyone who may see the todo may
+// comment on it, and users mentioned by email get notified.
+func (tc *TodoController) InsertComment(ctx *gin.Context) {
+	var input models.TodoCommentInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	comment, mentioned, err := tc.commentService.Create(id, currentUser.ID, input)
+	if err != nil {
+		commentError(ctx, err)
+		return
+	}
+	notifyMentions(currentUser, comment, mentioned)
+
+	response := helper.BuildResponse("OK", comment)
+	ctx.JSON(http.StatusCreated, response)
+}
+
+// UpdateComment changes a comment of the current user
+func (tc *TodoController) UpdateComment(ctx *gin.Context) {
+	var input models.TodoCommentInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	commentID, err := strconv.Atoi(ctx.Param("commentId"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param commentId was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	comment, mentioned, err := tc.commentService.Update(id, commentID, currentUser.ID, input)
+	if err != nil {
+		commentError(ctx, err)
+		return
+	}
+	notifyMentions(currentUser, comment, mentioned)
+
+	response := helper.BuildResponse("OK", comment)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// DeleteComment removes a comment of the current user
+func (tc *TodoController) DeleteComment(ctx *gin.Context) {
+	commentID, err := strconv.Atoi(ctx.Param("commentId"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param commentId was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := tc.commentService.Delete(id, commentID, currentUser.ID); err != nil {
+		commentError(ctx, err)
+		return
+	}
+
+	response := helper.BuildResponse("Deleted", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+// mentionExcerptLength bounds how much of a comment the mention email quotes
+const mentionExcerptLength = 500
+
+// notifyMentions emails the users a comment mentions. The comment is saved
+// already, so failures are only logged. The author's name, the title and the
+// comment are escaped by the email templates.
+func notifyMentions(author *models.User, comment models.TodoComment, mentioned []*models.User) {
+	if len(mentioned) == 0 {
+		return
+	}
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Println("Could not load config", err)
+		return
+	}
+
+	excerpt := []rune(comment.Body)
+	if len(excerpt) > mentionExcerptLength {
+		excerpt = append(excerpt[:mentionExcerptLength], '…')
+	}
+
+	for _, user := range mentioned {
+		// Users who turned mention emails off see them in the thread
+		if !user.Preferences.EmailMentions {
+			continue
+		}
+
+		// 👇 Send Email
+		emailData := utils.EmailData{
+			URL:         config.BaseUrl + "/api/todo/" + strconv.Itoa(comment.TodoID) + "/comments",
+			FirstName:   user.Name,
+			Subject:     author.Name + " mentioned you in a comment",
+			InviterName: author.Name,
+			TodoTitle:   comment.Todo.Title,
+			Comment:     string(excerpt),
+		}
+		if err := utils.SendEmail(user, &emailData, "todoMention.html"); err != nil {
+			log.Println("Could not send mention email", err)
+		}
+	}
+}
+
+func commentError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrCommentNotFound):
+		response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, response)
+	case errors.Is(err, services.ErrNotCommentAuthor):
+		response := helper.BuildErrorResponse("You dont have permission", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+	default:
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+	}
+}
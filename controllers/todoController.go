@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"golang/helper"
 	"golang/models"
@@ -12,18 +15,38 @@ import (
 )
 
 type TodoController struct {
-	todoService services.TodoService
+	todoService       services.TodoService
+	permissionService services.PermissionService
+	importService     services.TodoImportService
+	revisionService   services.TodoRevisionService
+	commentService    services.TodoCommentService
+	attachmentService services.TodoAttachmentService
+	auditService      services.AuditService
 }
 
-func NewTodoController(todoService services.TodoService) TodoController {
-	return TodoController{todoService}
+func NewTodoController(todoService services.TodoService, permissionService services.PermissionService, importService services.TodoImportService, revisionService services.TodoRevisionService, commentService services.TodoCommentService, attachmentService services.TodoAttachmentService, auditService services.AuditService) TodoController {
+	return TodoController{todoService, permissionService, importService, revisionService, commentService, attachmentService, auditService}
 }
 
 func (tc *TodoController) List(ctx *gin.Context) {
+	var filter models.TodoFilter
+	if err := ctx.ShouldBindQuery(&filter); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
 	currentUser := ctx.MustGet("currentUser").(*models.User)
 	userID := currentUser.ID
+
+	if filter.TodoListID != nil && !tc.permissionService.CanTodoList(userID, *filter.TodoListID, models.RoleViewer) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
 	var todos []*models.Todo
-	todos, err := tc.todoService.All(userID)
+	todos, err := tc.todoService.All(userID, filter)
 	if err != nil {
 		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
 		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
@@ -59,7 +82,7 @@ func (tc *TodoController) FindByID(ctx *gin.Context) {
 		return
 	}
 
-	if tc.todoService.IsAllowed(userID, id) {
+	if tc.permissionService.CanTodo(userID, id, models.RoleViewer) {
 		response := helper.BuildResponse("OK", todo)
 		ctx.JSON(http.StatusOK, response)
 		return
@@ -80,12 +103,28 @@ func (tc *TodoController) Insert(ctx *gin.Context) {
 	} else {
 		currentUser := ctx.MustGet("currentUser").(*models.User)
 		todoCreate.UserID = currentUser.ID
+		todoCreate.DefaultColorID = currentUser.Preferences.DefaultColorID
+		if todoCreate.DueTimezone == "" {
+			todoCreate.DueTimezone = currentUser.Preferences.Timezone
+		}
 		result, err := tc.todoService.Insert(todoCreate)
+		if errors.Is(err, services.ErrListNotFound) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidRecurrence) || errors.Is(err, services.ErrInvalidDue) {
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
 		if err != nil {
 			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
 			ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
 			return
 		}
+		audit(ctx, tc.auditService, auditTarget(models.AuditTodoCreate, models.AuditTargetTodo, result.ID), nil, result)
+
 		response := helper.BuildResponse("OK", result)
 		ctx.JSON(http.StatusCreated, response)
 		return
@@ -124,14 +163,26 @@ func (tc *TodoController) Update(ctx *gin.Context) {
 		return
 	}
 
-	if tc.todoService.IsAllowed(userID, id) {
-		todoUpdate.UserID = userID
-		result, err := tc.todoService.Update(id, todoUpdate)
+	if tc.permissionService.CanTodo(userID, id, models.RoleEditor) {
+		todoUpdate.UserID = todo.UserID
+		result, err := tc.todoService.Update(id, userID, todoUpdate)
+		if errors.Is(err, services.ErrListNotFound) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidRecurrence) || errors.Is(err, services.ErrInvalidDue) {
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
 		if err != nil {
 			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
 			ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
 			return
 		}
+		audit(ctx, tc.auditService, auditTarget(models.AuditTodoUpdate, models.AuditTargetTodo, id), todo, result)
+
 		response := helper.BuildResponse("OK", result)
 		ctx.JSON(http.StatusOK, response)
 		return
@@ -166,7 +217,7 @@ func (tc *TodoController) Delete(ctx *gin.Context) {
 		return
 	}
 
-	if tc.todoService.IsAllowed(userID, id) {
+	if tc.permissionService.CanTodo(userID, id, models.RoleEditor) {
 		todo.ID = id
 		err := tc.todoService.Delete(todo)
 		if err != nil {
@@ -174,6 +225,8 @@ func (tc *TodoController) Delete(ctx *gin.Context) {
 			ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
 			return
 		}
+		audit(ctx, tc.auditService, auditTarget(models.AuditTodoDelete, models.AuditTargetTodo, id), todo, nil)
+
 		response := helper.BuildResponse("Deleted", helper.EmptyObj{})
 		ctx.JSON(http.StatusOK, response)
 		return
@@ -183,3 +236,387 @@ func (tc *TodoController) Delete(ctx *gin.Context) {
 		return
 	}
 }
+
+func (tc *TodoController) Trash(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	todos, err := tc.todoService.Trash(currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", todos)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (tc *TodoController) Restore(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+
+	todo, err := tc.todoService.FindTrashedByID(id)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	if todo.ID != id {
+		res := helper.BuildErrorResponse("Data not found", "No trashed data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	if !tc.permissionService.CanTodo(currentUser.ID, id, models.RoleEditor) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	result, err := tc.todoService.Restore(todo)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoRestore, models.AuditTargetTodo, id), todo, result)
+
+	response := helper.BuildResponse("Restored", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (tc *TodoController) Purge(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+
+	todo, err := tc.todoService.FindTrashedByID(id)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	if todo.ID != id {
+		res := helper.BuildErrorResponse("Data not found", "No trashed data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	if !tc.permissionService.CanTodo(currentUser.ID, id, models.RoleOwner) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	err = tc.todoService.Purge(todo)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	// The todo is gone already, attachments left behind go with the next purge
+	if _, err := tc.attachmentService.PurgeOrphaned(); err != nil {
+		log.Println("Could not delete the attachments of todo", id, err)
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoPurge, models.AuditTargetTodo, id), todo, nil)
+
+	response := helper.BuildResponse("Deleted permanently", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+// todoBulkActions are the audit log actions of the bulk operations
+var todoBulkActions = map[string]string{
+	"delete":      models.AuditTodoDelete,
+	"restore":     models.AuditTodoRestore,
+	"setColor":    models.AuditTodoUpdate,
+	"setReminder": models.AuditTodoUpdate,
+	"complete":    models.AuditTodoComplete,
+	"moveToList":  models.AuditTodoMoveToList,
+}
+
+func (tc *TodoController) Bulk(ctx *gin.Context) {
+	var bulkInput models.TodoBulkInput
+	errDTO := ctx.ShouldBindJSON(&bulkInput)
+	if errDTO != nil {
+		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	results, err := tc.todoService.Bulk(currentUser.ID, bulkInput)
+	if err != nil {
+		if errors.Is(err, services.ErrColorNotFound) || errors.Is(err, services.ErrListNotFound) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	for _, result := range results {
+		if result.Success {
+			audit(ctx, tc.auditService, auditTarget(todoBulkActions[bulkInput.Operation], models.AuditTargetTodo, result.ID), result.Before, result.After)
+		}
+	}
+
+	response := helper.BuildResponse("OK", results)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (tc *TodoController) Move(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var moveInput models.MoveInput
+	errDTO := ctx.ShouldBindJSON(&moveInput)
+	if errDTO != nil {
+		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if (moveInput.BeforeID == nil) == (moveInput.AfterID == nil) {
+		response := helper.BuildErrorResponse("Failed to process request", "Exactly one of beforeId or afterId is required", helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	userID := currentUser.ID
+
+	if !tc.permissionService.CanTodo(userID, id, models.RoleEditor) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	todo, err := tc.todoService.FindByID(id, userID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	// Ranks are kept per creator, so the todo moves among its creator's todos
+	result, err := tc.todoService.Move(id, todo.UserID, moveInput)
+	if err != nil {
+		if errors.Is(err, services.ErrAnchorNotFound) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusNotFound, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoMove, models.AuditTargetTodo, id), todo, result)
+
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (tc *TodoController) MoveToList(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	var moveInput models.TodoListMoveInput
+	errDTO := ctx.ShouldBindJSON(&moveInput)
+	if errDTO != nil {
+		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	userID := currentUser.ID
+
+	if !tc.permissionService.CanTodo(userID, id, models.RoleEditor) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	todo, err := tc.todoService.FindByID(id, userID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	result, err := tc.todoService.MoveToList(id, userID, moveInput.TodoListID)
+	if err != nil {
+		if errors.Is(err, services.ErrListNotFound) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoMoveToList, models.AuditTargetTodo, id), todo, result)
+
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (tc *TodoController) Complete(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	userID := currentUser.ID
+
+	todo, err := tc.todoService.FindByID(id, userID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	if todo.ID != id {
+		res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	if !tc.permissionService.CanTodo(userID, id, models.RoleEditor) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	result, err := tc.todoService.Complete(todo, userID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoComplete, models.AuditTargetTodo, id), todo, result.Todo)
+	if result.Next != nil {
+		audit(ctx, tc.auditService, auditTarget(models.AuditTodoCreate, models.AuditTargetTodo, result.Next.ID), nil, result.Next)
+	}
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (tc *TodoController) Occurrences(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > 100 {
+		response := helper.BuildErrorResponse("Failed to process request", "limit must be between 1 and 100", helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	userID := currentUser.ID
+
+	todo, err := tc.todoService.FindByID(id, userID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	if todo.ID != id {
+		res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	if !tc.permissionService.CanTodo(userID, id, models.RoleViewer) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	occurrences, err := tc.todoService.Occurrences(todo, limit)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	response := helper.BuildResponse("OK", occurrences)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (tc *TodoController) Today(ctx *gin.Context) {
+	tc.smartList(ctx, func(userID int, loc *time.Location, query models.SmartListQuery) ([]*models.Todo, error) {
+		return tc.todoService.Today(userID, loc, time.Now())
+	})
+}
+
+func (tc *TodoController) Upcoming(ctx *gin.Context) {
+	tc.smartList(ctx, func(userID int, loc *time.Location, query models.SmartListQuery) ([]*models.Todo, error) {
+		currentUser := ctx.MustGet("currentUser").(*models.User)
+		return tc.todoService.Upcoming(userID, loc, currentUser.Preferences.FirstWeekday(), time.Now(), query.Days)
+	})
+}
+
+func (tc *TodoController) Overdue(ctx *gin.Context) {
+	tc.smartList(ctx, func(userID int, loc *time.Location, query models.SmartListQuery) ([]*models.Todo, error) {
+		return tc.todoService.Overdue(userID, loc, time.Now())
+	})
+}
+
+// smartList resolves the timezone days are counted in and writes the todos the
+// given view returns
+func (tc *TodoController) smartList(ctx *gin.Context, view func(int, *time.Location, models.SmartListQuery) ([]*models.Todo, error)) {
+	var query models.SmartListQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// Days follow the user's timezone unless the request asks for another one
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	loc := currentUser.Preferences.Location()
+	if query.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(query.Timezone)
+		if err != nil {
+			response := helper.BuildErrorResponse("Timezone is invalid", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	todos, err := view(currentUser.ID, loc, query)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", todos)
+	ctx.JSON(http.StatusOK, response)
+}
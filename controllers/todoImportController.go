@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize bounds the size of an uploaded import file
+const maxImportSize = 10 << 20
+
+// Import starts importing the uploaded file in the background. The job it returns
+// reports the progress, the per-row errors and, for a dry run, a preview.
+func (tc *TodoController) Import(ctx *gin.Context) {
+	var input models.TodoImportInput
+	if err := ctx.ShouldBind(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+	if header.Size > maxImportSize {
+		response := helper.BuildErrorResponse("Failed to process request", "The file is larger than 10 MB", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, response)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	job, err := tc.importService.Create(currentUser.ID, input, header.Filename, string(content))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImport) {
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+			return
+		}
+		if errors.Is(err, services.ErrListNotFound) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", job)
+	ctx.JSON(http.StatusAccepted, response)
+}
+
+func (tc *TodoController) FindImport(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	job, err := tc.importService.FindByID(id, currentUser.ID)
+	if err != nil {
+		res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	response := helper.BuildResponse("OK", job)
+	ctx.JSON(http.StatusOK, response)
+}
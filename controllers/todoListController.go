@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TodoListController struct {
+	todoListService   services.TodoListService
+	shareService      services.TodoListShareService
+	permissionService services.PermissionService
+	userService       services.UserService
+}
+
+func NewTodoListController(todoListService services.TodoListService, shareService services.TodoListShareService, permissionService services.PermissionService, userService services.UserService) TodoListController {
+	return TodoListController{todoListService, shareService, permissionService, userService}
+}
+
+func (lc *TodoListController) List(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	archived := ctx.Query("archived") == "true"
+
+	todoLists, err := lc.todoListService.All(currentUser.ID, archived)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", todoLists)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) FindByID(ctx *gin.Context) {
+	todoList, ok := lc.findAllowed(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	response := helper.BuildResponse("OK", todoList)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) Insert(ctx *gin.Context) {
+	var todoListCreate models.TodoListInput
+	errDTO := ctx.ShouldBind(&todoListCreate)
+	if errDTO != nil {
+		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	todoListCreate.UserID = currentUser.ID
+	result, err := lc.todoListService.Insert(todoListCreate)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusCreated, response)
+}
+
+func (lc *TodoListController) Update(ctx *gin.Context) {
+	todoList, ok := lc.findAllowed(ctx, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	var todoListUpdate models.TodoListInput
+	errDTO := ctx.ShouldBind(&todoListUpdate)
+	if errDTO != nil {
+		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	todoListUpdate.UserID = todoList.UserID
+	result, err := lc.todoListService.Update(todoList.ID, todoListUpdate)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) Delete(ctx *gin.Context) {
+	todoList, ok := lc.findAllowed(ctx, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var deleteInput models.TodoListDeleteInput
+	errDTO := ctx.ShouldBindQuery(&deleteInput)
+	if errDTO != nil {
+		response := helper.BuildErrorResponse("Choose whether to move or trash the todos of this list", errDTO.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	err := lc.todoListService.Delete(todoList, deleteInput)
+	if err != nil {
+		if errors.Is(err, services.ErrListNotFound) {
+			response := helper.BuildErrorResponse("Data not found", "No target list with given id", helper.EmptyObj{})
+			ctx.JSON(http.StatusBadRequest, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("Deleted", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) Move(ctx *gin.Context) {
+	todoList, ok := lc.findAllowed(ctx, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var moveInput models.MoveInput
+	errDTO := ctx.ShouldBindJSON(&moveInput)
+	if errDTO != nil {
+		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if (moveInput.BeforeID == nil) == (moveInput.AfterID == nil) {
+		response := helper.BuildErrorResponse("Failed to process request", "Exactly one of beforeId or afterId is required", helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	result, err := lc.todoListService.Move(todoList.ID, todoList.UserID, moveInput)
+	if err != nil {
+		if errors.Is(err, services.ErrAnchorNotFound) {
+			response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusNotFound, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// findAllowed loads the list from the id param and writes the error response when
+// it is missing or the current user lacks the required role on it
+func (lc *TodoListController) findAllowed(ctx *gin.Context, required string) (models.TodoList, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return models.TodoList{}, false
+	}
+
+	todoList, err := lc.todoListService.FindByID(id)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return models.TodoList{}, false
+	}
+	if todoList.ID != id {
+		res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return models.TodoList{}, false
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if !lc.permissionService.CanTodoList(currentUser.ID, id, required) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return models.TodoList{}, false
+	}
+	return todoList, true
+}
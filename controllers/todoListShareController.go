@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+
+	"golang/config"
+	"golang/helper"
+	"golang/models"
+	"golang/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/thanhpk/randstr"
+)
+
+func (lc *TodoListController) Shares(ctx *gin.Context) {
+	todoList, ok := lc.findAllowed(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	shares, err := lc.shareService.All(todoList.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", shares)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) Share(ctx *gin.Context) {
+	todoList, ok := lc.findAllowed(ctx, models.RoleOwner)
+	if !ok {
+		return
+	}
+
+	var shareInput models.TodoListShareInput
+	if err := ctx.ShouldBindJSON(&shareInput); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if _, err := mail.ParseAddress(shareInput.Email); err != nil {
+		response := helper.BuildErrorResponse("Email is invalid", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	invitee, err := lc.userService.FindUserByEmail(shareInput.Email)
+	if err != nil {
+		response := helper.BuildErrorResponse("Data not found", "No registered user with given email", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if invitee.ID == todoList.UserID {
+		response := helper.BuildErrorResponse("Failed to process request", "The list already belongs to this user", helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// Generate Invitation Token
+	token := randstr.String(20)
+	share, err := lc.shareService.Invite(models.TodoListShare{
+		TodoListID:  todoList.ID,
+		UserID:      invitee.ID,
+		Email:       invitee.Email,
+		Role:        shareInput.Role,
+		Token:       utils.Encode(token),
+		InvitedByID: currentUser.ID,
+	})
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	// Invitees who turned invitation emails off find it under their pending invitations
+	if !invitee.Preferences.EmailInvitations {
+		response := helper.BuildResponse("OK", share)
+		ctx.JSON(http.StatusCreated, response)
+		return
+	}
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Println("Could not load config", err)
+		response := helper.BuildErrorResponse("Failed to process request", "could not load config", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	// 👇 Send Email
+	emailData := utils.EmailData{
+		URL:         config.BaseUrl + "/api/todolist/acceptinvitation/" + token,
+		FirstName:   invitee.Name,
+		Subject:     currentUser.Name + " shared a todo list with you",
+		InviterName: currentUser.Name,
+		ListName:    todoList.Name,
+	}
+
+	err = utils.SendEmail(invitee, &emailData, "shareInvitation.html")
+	if err != nil {
+		response := helper.BuildErrorResponse("There was an error sending email", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("We sent an invitation to "+invitee.Email, share)
+	ctx.JSON(http.StatusCreated, response)
+}
+
+func (lc *TodoListController) UpdateShare(ctx *gin.Context) {
+	share, ok := lc.findShare(ctx)
+	if !ok {
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if !lc.permissionService.CanTodoList(currentUser.ID, share.TodoListID, models.RoleOwner) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	var roleInput models.TodoListShareRoleInput
+	if err := ctx.ShouldBindJSON(&roleInput); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	result, err := lc.shareService.UpdateRole(share.ID, roleInput.Role)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Unshare revokes a share. Owners can remove anyone, the invitee can leave on their own.
+func (lc *TodoListController) Unshare(ctx *gin.Context) {
+	share, ok := lc.findShare(ctx)
+	if !ok {
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if share.UserID != currentUser.ID && !lc.permissionService.CanTodoList(currentUser.ID, share.TodoListID, models.RoleOwner) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	err := lc.shareService.Delete(share)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("Deleted", helper.EmptyObj{})
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) Invitations(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	shares, err := lc.shareService.Invitations(currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", shares)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) AcceptInvitation(ctx *gin.Context) {
+	lc.respondInvitation(ctx, true)
+}
+
+func (lc *TodoListController) DeclineInvitation(ctx *gin.Context) {
+	lc.respondInvitation(ctx, false)
+}
+
+func (lc *TodoListController) respondInvitation(ctx *gin.Context, accept bool) {
+	token := utils.Encode(ctx.Params.ByName("invitationToken"))
+
+	share, err := lc.shareService.FindByToken(token)
+	if err != nil {
+		response := helper.BuildErrorResponse("Invitation not found", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if share.UserID != currentUser.ID || share.Status != models.SharePending {
+		response := helper.BuildResponse("This invitation is not for you", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return
+	}
+
+	result, err := lc.shareService.Respond(share, accept)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	response := helper.BuildResponse("OK", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (lc *TodoListController) findShare(ctx *gin.Context) (models.TodoListShare, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return models.TodoListShare{}, false
+	}
+
+	share, err := lc.shareService.FindByID(id)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return models.TodoListShare{}, false
+	}
+	if share.ID != id {
+		res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return models.TodoListShare{}, false
+	}
+	return share, true
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"golang/helper"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Revisions lists the past states of a todo, latest first
+func (tc *TodoController) Revisions(ctx *gin.Context) {
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	revisions, err := tc.revisionService.All(id)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	response := helper.BuildResponse("OK", revisions)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RevisionDiff lists the fields changed between two revisions of a todo
+func (tc *TodoController) RevisionDiff(ctx *gin.Context) {
+	var query models.TodoRevisionDiffQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleViewer)
+	if !ok {
+		return
+	}
+
+	diff, err := tc.revisionService.Diff(id, query.From, query.To)
+	if err != nil {
+		revisionError(ctx, err)
+		return
+	}
+	response := helper.BuildResponse("OK", diff)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RestoreRevision brings a todo back to the state of one of its revisions
+func (tc *TodoController) RestoreRevision(ctx *gin.Context) {
+	number, err := strconv.Atoi(ctx.Param("number"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param number was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	id, ok := tc.allowedTodo(ctx, models.RoleEditor)
+	if !ok {
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	todo, err := tc.todoService.FindByID(id, currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	if todo.ID != id {
+		res := helper.BuildErrorResponse("Data not found", "No data with given id", helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, res)
+		return
+	}
+
+	result, err := tc.revisionService.Restore(id, number, currentUser.ID)
+	if err != nil {
+		revisionError(ctx, err)
+		return
+	}
+	audit(ctx, tc.auditService, auditTarget(models.AuditTodoRevisionRestore, models.AuditTargetTodo, id), todo, result)
+
+	response := helper.BuildResponse("Restored", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+// allowedTodo reads the id of the todo of the request, making sure the current
+// user has the role on it
+func (tc *TodoController) allowedTodo(ctx *gin.Context, role string) (int, bool) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		response := helper.BuildErrorResponse("No param id was found", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return 0, false
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if !tc.permissionService.CanTodo(currentUser.ID, id, role) {
+		response := helper.BuildResponse("You dont have permission", helper.EmptyObj{})
+		ctx.JSON(http.StatusForbidden, response)
+		return 0, false
+	}
+	return id, true
+}
+
+func revisionError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrRevisionNotFound):
+		response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusNotFound, response)
+	case errors.Is(err, services.ErrListNotFound):
+		response := helper.BuildErrorResponse("Data not found", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+	default:
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+	}
+}
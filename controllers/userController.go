@@ -1,21 +1,29 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
 
+	"golang/config"
 	"golang/helper"
 	"golang/models"
 	"golang/services"
+	"golang/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type UserController struct {
-	userService services.UserService
+	userService  services.UserService
+	auditService services.AuditService
 }
 
-func NewUserController(userService services.UserService) UserController {
-	return UserController{userService}
+func NewUserController(userService services.UserService, auditService services.AuditService) UserController {
+	return UserController{userService, auditService}
 }
 
 func (uc *UserController) Profile(ctx *gin.Context) {
@@ -24,22 +32,262 @@ func (uc *UserController) Profile(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
+// Update changes the profile: name, avatar and optionally the preferences. The
+// password has its own endpoint.
 func (uc *UserController) Update(ctx *gin.Context) {
-	var userUpdateDTO *models.UserEdit
-	errDTO := ctx.ShouldBind(&userUpdateDTO)
+	var userUpdateDTO models.UserEdit
+	errDTO := ctx.ShouldBindJSON(&userUpdateDTO)
 	if errDTO != nil {
 		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
 		return
 	}
 
-	result, err := uc.userService.Update(userUpdateDTO)
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	result, err := uc.userService.Update(currentUser.ID, userUpdateDTO)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidPreferences) || errors.Is(err, services.ErrColorNotFound) {
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, uc.auditService, auditUser(models.AuditUserUpdate, currentUser.ID), models.FilteredResponse(currentUser), models.FilteredResponse(result))
+
+	response := helper.BuildResponse("OK", models.FilteredResponse(result))
+	ctx.JSON(http.StatusOK, response)
+}
+
+// ChangePassword replaces the password after checking the current one. Every
+// other session is logged out while this one gets new tokens.
+func (uc *UserController) ChangePassword(ctx *gin.Context) {
+	var input models.ChangePasswordInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// The config is loaded before anything changes so a failure leaves the
+	// password as it was
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Println("Could not load config", err)
+		response := helper.BuildErrorResponse("Failed to process request", "could not load config", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := utils.VerifyPassword(currentUser.Password, input.CurrentPassword); err != nil {
+		response := helper.BuildErrorResponse("invalid Password", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if err := utils.CheckPassword(input.Password, currentUser.Name, currentUser.Email); err != nil {
+		abortWeakPassword(ctx, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	changedAt, err := uc.userService.ChangePassword(currentUser.ID, hashedPassword)
+	if err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, uc.auditService, auditUser(models.AuditPasswordChange, currentUser.ID), nil, nil)
+
+	access_token, err := startSession(ctx, currentUser.ID)
+	if err != nil {
+		response := helper.BuildErrorResponse("error create access token", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	// 👇 Send Email
+	emailData := utils.EmailData{
+		URL:       config.BaseUrl + "/api/auth/forgotpassword",
+		FirstName: currentUser.Name,
+		Subject:   "Your password was changed",
+		When:      utils.FormatTime(changedAt, currentUser.Preferences),
+	}
+	if err := utils.SendEmail(currentUser, &emailData, "passwordChanged.html"); err != nil {
+		log.Println("Could not send password change email", err)
+	}
+
+	result := make(map[string]string)
+	result["access_token"] = access_token
+	response := helper.BuildResponse("Password changed successfully", result)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (uc *UserController) Preferences(ctx *gin.Context) {
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	response := helper.BuildResponse("OK", currentUser.Preferences)
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (uc *UserController) UpdatePreferences(ctx *gin.Context) {
+	var preferencesInput models.UserPreferencesInput
+	errDTO := ctx.ShouldBindJSON(&preferencesInput)
+	if errDTO != nil {
 		response := helper.BuildErrorResponse("Failed to process request", errDTO.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	result, err := uc.userService.UpdatePreferences(currentUser.ID, preferencesInput)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPreferences) || errors.Is(err, services.ErrColorNotFound) {
+			response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
 		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
 		return
 	}
 
-	response := helper.BuildResponse("OK", result)
+	audit(ctx, uc.auditService, auditUser(models.AuditPreferencesUpdate, currentUser.ID), currentUser.Preferences, result.Preferences)
+
+	response := helper.BuildResponse("OK", result.Preferences)
 	ctx.JSON(http.StatusOK, response)
 }
+
+// Delete schedules the deletion of the account after a grace period. Logging in
+// again before it ends cancels the deletion.
+func (uc *UserController) Delete(ctx *gin.Context) {
+	var input models.DeleteAccountInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := utils.VerifyPassword(currentUser.Password, input.Password); err != nil {
+		response := helper.BuildErrorResponse("invalid Password", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Println("Could not load config", err)
+		response := helper.BuildErrorResponse("Failed to process request", "could not load config", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	deletionAt := time.Now().Add(config.AccountDeletionGrace)
+	if err := uc.userService.ScheduleDeletion(currentUser.ID, deletionAt); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, uc.auditService, auditUser(models.AuditDeletionScheduled, currentUser.ID), nil, gin.H{"deletionScheduledAt": deletionAt})
+
+	// 👇 Send Email
+	emailData := utils.EmailData{
+		URL:       config.BaseUrl + "/api/auth/login",
+		FirstName: currentUser.Name,
+		Subject:   "Your account is scheduled for deletion",
+		When:      utils.FormatTime(deletionAt, currentUser.Preferences),
+	}
+	if err := utils.SendEmail(currentUser, &emailData, "accountDeletion.html"); err != nil {
+		log.Println("Could not send account deletion email", err)
+	}
+
+	endSession(ctx)
+
+	response := helper.BuildResponse("OK", gin.H{"deletionScheduledAt": deletionAt})
+	ctx.JSON(http.StatusAccepted, response)
+}
+
+// ChangeEmail asks the new address to confirm the change and tells the old one how
+// to revert it. The email only changes once confirmed.
+func (uc *UserController) ChangeEmail(ctx *gin.Context) {
+	var input models.ChangeEmailInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	if _, err := mail.ParseAddress(input.Email); err != nil {
+		response := helper.BuildErrorResponse("Email is invalid", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	currentUser := ctx.MustGet("currentUser").(*models.User)
+	if err := utils.VerifyPassword(currentUser.Password, input.Password); err != nil {
+		response := helper.BuildErrorResponse("invalid Password", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, response)
+		return
+	}
+
+	confirmToken, revertToken, err := uc.userService.RequestEmailChange(currentUser, input.Email)
+	if err != nil {
+		if errors.Is(err, services.ErrEmailTaken) || strings.Contains(err.Error(), "duplicate key value") {
+			response := helper.BuildErrorResponse("name or email already exist", err.Error(), helper.EmptyObj{})
+			ctx.JSON(http.StatusConflict, response)
+			return
+		}
+		response := helper.BuildErrorResponse("Failed to process request", err.Error(), helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+	audit(ctx, uc.auditService, auditUser(models.AuditEmailChangeRequested, currentUser.ID), nil, gin.H{"email": strings.ToLower(input.Email)})
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Println("Could not load config", err)
+		response := helper.BuildErrorResponse("Failed to process request", "could not load config", helper.EmptyObj{})
+		ctx.AbortWithStatusJSON(http.StatusBadGateway, response)
+		return
+	}
+
+	// 👇 Send Email
+	newAddress := *currentUser
+	newAddress.Email = strings.ToLower(input.Email)
+	emailData := utils.EmailData{
+		URL:       config.BaseUrl + "/api/auth/confirmemail/" + confirmToken,
+		FirstName: currentUser.Name,
+		Subject:   "Confirm your new email",
+		Email:     newAddress.Email,
+	}
+	if err := utils.SendEmail(&newAddress, &emailData, "emailChangeConfirm.html"); err != nil {
+		response := helper.BuildErrorResponse("There was an error sending email", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadGateway, response)
+		return
+	}
+
+	emailData = utils.EmailData{
+		URL:       config.BaseUrl + "/api/auth/revertemail/" + revertToken,
+		FirstName: currentUser.Name,
+		Subject:   "Your account email is being changed",
+		Email:     newAddress.Email,
+	}
+	if err := utils.SendEmail(currentUser, &emailData, "emailChangeNotice.html"); err != nil {
+		response := helper.BuildErrorResponse("There was an error sending email", err.Error(), helper.EmptyObj{})
+		ctx.JSON(http.StatusBadGateway, response)
+		return
+	}
+
+	message := "We sent an email with a confirmation link to " + newAddress.Email
+	response := helper.BuildResponse("OK", message)
+	ctx.JSON(http.StatusAccepted, response)
+}
@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"golang/config"
 	"golang/controllers"
+	"golang/models"
 	"golang/routes"
 	"golang/services"
+	"golang/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -24,6 +28,10 @@ var (
 	ctx            context.Context
 	postgresclient *sql.DB
 
+	auditService         services.AuditService
+	auditController      controllers.AuditController
+	auditRouteController routes.AuditRouteController
+
 	userService         services.UserService
 	userController      controllers.UserController
 	userRouteController routes.UserRouteController
@@ -32,13 +40,50 @@ var (
 	authController      controllers.AuthController
 	authRouteController routes.AuthRouteController
 
-	todoService         services.TodoService
-	todoController      controllers.TodoController
-	todoRouteController routes.TodoRouteController
+	todoService           services.TodoService
+	todoImportService     services.TodoImportService
+	todoRevisionService   services.TodoRevisionService
+	todoCommentService    services.TodoCommentService
+	todoAttachmentService services.TodoAttachmentService
+	todoController        controllers.TodoController
+	todoRouteController   routes.TodoRouteController
+
+	permissionService services.PermissionService
+
+	todoListService         services.TodoListService
+	todoListShareService    services.TodoListShareService
+	todoListController      controllers.TodoListController
+	todoListRouteController routes.TodoListRouteController
+
+	reminderService services.ReminderService
 
 	colorService         services.ColorService
 	colorController      controllers.ColorController
 	colorRouteController routes.ColorRouteController
+
+	feedService         services.FeedService
+	feedController      controllers.FeedController
+	feedRouteController routes.FeedRouteController
+
+	exportService         services.ExportService
+	exportController      controllers.ExportController
+	exportRouteController routes.ExportRouteController
+
+	accessTokenService         services.AccessTokenService
+	accessTokenController      controllers.AccessTokenController
+	accessTokenRouteController routes.AccessTokenRouteController
+
+	identityService         services.IdentityService
+	identityController      controllers.IdentityController
+	identityRouteController routes.IdentityRouteController
+
+	oauthService         services.OAuthService
+	oauthController      controllers.OAuthController
+	oauthRouteController routes.OAuthRouteController
+
+	signingKeyService  services.SigningKeyService
+	keyController      controllers.KeyController
+	keyRouteController routes.KeyRouteController
 )
 
 func init() {
@@ -61,23 +106,75 @@ func init() {
 		log.Fatal("Failed to connect mysql")
 	}
 
-	// db.AutoMigrate(&models.DBResponse{})
+	err = db.AutoMigrate(&models.User{}, &models.Color{}, &models.TodoList{}, &models.Todo{}, &models.TodoReminder{}, &models.TodoListShare{}, &models.TodoImport{}, &models.Export{}, &models.AccountDeletion{}, &models.EmailChange{}, &models.AccessToken{}, &models.UserIdentity{}, &models.OIDCLogin{}, &models.OAuthClient{}, &models.OAuthCode{}, &models.OAuthGrant{}, &models.SigningKey{}, &models.MagicLink{}, &models.AuditLog{}, &models.TodoRevision{}, &models.TodoComment{}, &models.TodoAttachment{})
+	if err != nil {
+		log.Fatal("Failed to migrate database ", err)
+	}
+
+	auditService = services.NewAuditService(db)
+	auditController = controllers.NewAuditController(auditService)
+	auditRouteController = routes.NewRouteAuditController(auditController)
+
 	userService = services.NewUserService(db)
-	userController = controllers.NewUserController(userService)
+	userController = controllers.NewUserController(userService, auditService)
 	userRouteController = routes.NewRouteUserController(userController)
 
 	authService = services.NewAuthService(db)
-	authController = controllers.NewAuthController(authService, userService, ctx, db)
+	authController = controllers.NewAuthController(authService, userService, auditService, ctx, db)
 	authRouteController = routes.NewAuthRouteController(authController)
 
+	permissionService = services.NewPermissionService(db)
+
 	todoService = services.NewTodoService(db)
-	todoController = controllers.NewTodoController(todoService)
+	todoImportService = services.NewTodoImportService(db)
+	todoRevisionService = services.NewTodoRevisionService(db)
+	todoCommentService = services.NewTodoCommentService(db)
+	storage, err := utils.NewStorage(config)
+	if err != nil {
+		log.Fatal("Failed to set up the attachment storage ", err)
+	}
+	todoAttachmentService = services.NewTodoAttachmentService(db, storage)
+	todoController = controllers.NewTodoController(todoService, permissionService, todoImportService, todoRevisionService, todoCommentService, todoAttachmentService, auditService)
 	todoRouteController = routes.NewRouteTodoController(todoController)
 
+	todoListService = services.NewTodoListService(db)
+	todoListShareService = services.NewTodoListShareService(db)
+	todoListController = controllers.NewTodoListController(todoListService, todoListShareService, permissionService, userService)
+	todoListRouteController = routes.NewRouteTodoListController(todoListController)
+
+	reminderService = services.NewReminderService(db)
+
 	colorService = services.NewColorService(db)
-	colorController = controllers.NewColorController(colorService)
+	colorController = controllers.NewColorController(colorService, auditService)
 	colorRouteController = routes.NewRouteColorController(colorController)
 
+	feedService = services.NewFeedService(db)
+	feedController = controllers.NewFeedController(feedService)
+	feedRouteController = routes.NewRouteFeedController(feedController)
+
+	exportService = services.NewExportService(db)
+	exportController = controllers.NewExportController(exportService)
+	exportRouteController = routes.NewRouteExportController(exportController)
+
+	accessTokenService = services.NewAccessTokenService(db)
+	accessTokenController = controllers.NewAccessTokenController(accessTokenService)
+	accessTokenRouteController = routes.NewRouteAccessTokenController(accessTokenController)
+
+	identityService = services.NewIdentityService(db)
+	identityController = controllers.NewIdentityController(identityService, userService)
+	identityRouteController = routes.NewRouteIdentityController(identityController)
+
+	oauthService = services.NewOAuthService(db)
+	oauthController = controllers.NewOAuthController(oauthService)
+	oauthRouteController = routes.NewRouteOAuthController(oauthController)
+
+	signingKeyService = services.NewSigningKeyService(db)
+	if err := signingKeyService.Load(); err != nil {
+		log.Fatal("Failed to load signing keys ", err)
+	}
+	keyController = controllers.NewKeyController()
+	keyRouteController = routes.NewRouteKeyController(keyController)
+
 	server = gin.Default()
 }
 
@@ -89,15 +186,26 @@ func main() {
 
 	defer postgresclient.Close()
 
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowOrigins = []string{"*"}
-	corsConfig.AllowCredentials = true
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		rotateKeys(os.Args[2:])
+		return
+	}
 
-	server.Use(cors.New(corsConfig))
+	// Only listed origins may call the API with the cookies of the user
+	if len(config.CORSAllowedOrigins) > 0 {
+		corsConfig := cors.DefaultConfig()
+		corsConfig.AllowOrigins = config.CORSAllowedOrigins
+		corsConfig.AllowCredentials = true
+		corsConfig.AddAllowHeaders("Authorization", "X-CSRF-Token")
+
+		server.Use(cors.New(corsConfig))
+	}
 	server.GET("/", func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "welcome"})
 	})
 
+	keyRouteController.KeyRoute(&server.RouterGroup)
+
 	router := server.Group("/api")
 	router.GET("/healthchecker", func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, gin.H{"status": "success", "message": "status ok"})
@@ -106,7 +214,64 @@ func main() {
 	authRouteController.AuthRoute(router, userService)
 	userRouteController.UserRoute(router, userService)
 	todoRouteController.TodoRoute(router, userService)
+	todoListRouteController.TodoListRoute(router, userService)
 	colorRouteController.ColorRoute(router, userService)
+	feedRouteController.FeedRoute(router, userService)
+	exportRouteController.ExportRoute(router, userService)
+	accessTokenRouteController.AccessTokenRoute(router, userService)
+	identityRouteController.IdentityRoute(router, userService)
+	oauthRouteController.OAuthRoute(router, userService)
+	auditRouteController.AuditRoute(router, userService)
+
+	utils.Schedule("purge trash", config.PurgeInterval, func() error {
+		before := time.Now().Add(-config.TrashRetention)
+		if _, err := todoService.PurgeTrashed(before); err != nil {
+			return err
+		}
+		if _, err := todoAttachmentService.PurgeOrphaned(); err != nil {
+			return err
+		}
+		_, err := colorService.PurgeTrashed(before)
+		return err
+	})
+	utils.Schedule("send reminders", time.Minute, func() error {
+		_, err := reminderService.SendDue(time.Now())
+		return err
+	})
+	utils.Schedule("run imports", time.Minute, func() error {
+		_, err := todoImportService.RunPending()
+		return err
+	})
+	utils.Schedule("build exports", time.Minute, func() error {
+		_, err := exportService.RunPending()
+		return err
+	})
+	utils.Schedule("delete accounts", config.PurgeInterval, func() error {
+		_, err := userService.DeleteScheduled(time.Now())
+		return err
+	})
+	utils.Schedule("purge exports", config.PurgeInterval, func() error {
+		_, err := exportService.PurgeExpired(time.Now())
+		return err
+	})
+	utils.Schedule("reload signing keys", time.Minute, signingKeyService.Load)
 
 	log.Fatal(server.Run(":" + config.Port))
 }
+
+// rotateKeys adds new signing keys, for the purposes given or both of them:
+//
+//	go run . rotate-keys [access] [refresh]
+func rotateKeys(purposes []string) {
+	if len(purposes) == 0 {
+		purposes = []string{models.KeyPurposeAccess, models.KeyPurposeRefresh}
+	}
+
+	for _, purpose := range purposes {
+		key, err := signingKeyService.Rotate(purpose)
+		if err != nil {
+			log.Fatal("Failed to rotate ", purpose, " key: ", err)
+		}
+		fmt.Printf("New %s key %s signs tokens from %s\n", purpose, key.Kid, key.ActivatesAt.Format(time.RFC3339))
+	}
+}
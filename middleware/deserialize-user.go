@@ -5,7 +5,7 @@ import (
 	"net/http"
 	"strings"
 
-	"golang/config"
+	"golang/models"
 	"golang/services"
 	"golang/utils"
 
@@ -15,6 +15,7 @@ import (
 func DeserializeUser(userService services.UserService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var access_token string
+		var fromCookie bool
 		cookie, err := ctx.Cookie("access_token")
 
 		authorizationHeader := ctx.Request.Header.Get("Authorization")
@@ -24,6 +25,7 @@ func DeserializeUser(userService services.UserService) gin.HandlerFunc {
 			access_token = fields[1]
 		} else if err == nil {
 			access_token = cookie
+			fromCookie = true
 		}
 
 		if access_token == "" {
@@ -31,16 +33,65 @@ func DeserializeUser(userService services.UserService) gin.HandlerFunc {
 			return
 		}
 
-		config, _ := config.LoadConfig()
-		sub, err := utils.ValidateToken(access_token, config.AccessTokenPublicKey)
+		// Browsers send the cookie along with requests other sites make
+		if fromCookie && !validCSRF(ctx) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "Missing or invalid CSRF token"})
+			return
+		}
+
+		// Personal access tokens authenticate scripts, RequireScope limits what they reach
+		if strings.HasPrefix(access_token, models.AccessTokenPrefix) {
+			user, accessToken, err := userService.FindUserByAccessToken(access_token)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The access token is invalid or expired"})
+				return
+			}
+			if user.DeletionScheduledAt != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The account is scheduled for deletion, log in again to cancel it"})
+				return
+			}
+
+			ctx.Set("currentUser", user)
+			ctx.Set("accessToken", accessToken)
+			ctx.Set("scopes", accessToken.Scopes)
+			ctx.Next()
+			return
+		}
+
+		claims, err := utils.ParseToken(access_token, utils.AccessTokenKeys)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": err.Error()})
 			return
 		}
 
-		user, err := userService.FindUserById(fmt.Sprint(sub))
-		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The user belonging to this token no logger exists"})
+		// Access tokens of third-party apps are limited to their scopes and stop
+		// working once the user revokes the app
+		var user *models.User
+		if grantID, ok := claims["grant"].(float64); ok {
+			var grant *models.OAuthGrant
+			user, grant, err = userService.FindUserByOAuthGrant(int(grantID))
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The access token was revoked"})
+				return
+			}
+			scope, _ := claims["scope"].(string)
+			ctx.Set("oauthGrant", grant)
+			ctx.Set("scopes", models.Scopes(strings.Fields(scope)))
+		} else {
+			user, err = userService.FindUserById(fmt.Sprint(claims["sub"]))
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The user belonging to this token no logger exists"})
+				return
+			}
+		}
+
+		if user.DeletionScheduledAt != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The account is scheduled for deletion, log in again to cancel it"})
+			return
+		}
+
+		if user.SessionsValidAfter != nil && utils.IssuedBefore(claims, *user.SessionsValidAfter) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": "fail", "message": "The session was revoked, log in again"})
 			return
 		}
 
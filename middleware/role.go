@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"net/http"
+
+	"golang/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole lets only users with the role through, such as admins reading
+// the audit log of everyone
+func RequireRole(role string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		currentUser := ctx.MustGet("currentUser").(*models.User)
+		if currentUser.Role != role {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "You dont have permission"})
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"golang/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope checks that a request authenticated with a personal access token
+// or the access token of a third-party app has the scope of the resource: read
+// for GET requests, write for the others. Requests with a login session may
+// reach everything.
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value, ok := ctx.Get("scopes")
+		if !ok {
+			ctx.Next()
+			return
+		}
+
+		write := ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead
+		if !value.(models.Scopes).Allows(resource, write) {
+			scope := resource + ":read"
+			if write {
+				scope = resource + ":write"
+			}
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "The access token lacks the " + scope + " scope"})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// RequireSession keeps personal access tokens and third-party apps away from
+// account security endpoints, such as changing the password or managing the
+// tokens themselves
+func RequireSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, ok := ctx.Get("scopes"); ok {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": "fail", "message": "This endpoint needs a login session, not an access token"})
+			return
+		}
+		ctx.Next()
+	}
+}
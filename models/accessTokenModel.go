@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// AccessTokenPrefix starts every personal access token, telling them apart from
+// JWTs in the Authorization header
+const AccessTokenPrefix = "pat_"
+
+// AccessTokenScopes grant read or write access to one resource, write implying read
+var AccessTokenScopes = []string{
+	"todo:read", "todo:write",
+	"todolist:read", "todolist:write",
+	"color:read", "color:write",
+	"user:read", "user:write",
+	"export:read", "export:write",
+}
+
+// AccessToken is a personal access token scripts authenticate with. Only its hash
+// is stored, the token itself is shown once when it's created.
+type AccessToken struct {
+	ID         int        `gorm:"primary_key:auto_increment" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Hint       string     `gorm:"not null" json:"hint"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	Scopes     Scopes     `gorm:"type:text" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UserID     int        `gorm:"not null;index" json:"userId"`
+	User       User       `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (AccessToken) TableName() string {
+	return "access_token"
+}
+
+type Scopes []string
+
+func (s Scopes) Value() (driver.Value, error) {
+	return valueJSON(s)
+}
+
+func (s *Scopes) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// Allows tells whether the scopes grant access to a resource, write access
+// including read access
+func (s Scopes) Allows(resource string, write bool) bool {
+	for _, scope := range s {
+		if scope == resource+":write" || (!write && scope == resource+":read") {
+			return true
+		}
+	}
+	return false
+}
+
+type AccessTokenInput struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=todo:read todo:write todolist:read todolist:write color:read color:write user:read user:write export:read export:write"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// AccessTokenCreated carries the token, which can't be retrieved later
+type AccessTokenCreated struct {
+	Token       string      `json:"token"`
+	AccessToken AccessToken `json:"accessToken"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// AccountDeletion records that an account was deleted. It keeps nothing that
+// identifies the user, only when it happened and how much data was removed.
+type AccountDeletion struct {
+	ID           int       `gorm:"primary_key:auto_increment" json:"id"`
+	ScheduledFor time.Time `json:"scheduledFor"`
+	DeletedAt    time.Time `json:"deletedAt"`
+	Todos        int64     `gorm:"not null;default:0" json:"todos"`
+	TodoLists    int64     `gorm:"not null;default:0" json:"todoLists"`
+}
+
+func (AccountDeletion) TableName() string {
+	return "account_deletion"
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditSignUp                 = "auth.signup"
+	AuditLogin                  = "auth.login"
+	AuditLoginFailed            = "auth.login_failed"
+	AuditMagicLinkRequested     = "auth.magic_link_requested"
+	AuditMagicLinkLogin         = "auth.magic_link_login"
+	AuditLogout                 = "auth.logout"
+	AuditEmailVerified          = "auth.email_verified"
+	AuditPasswordResetRequested = "auth.password_reset_requested"
+	AuditPasswordReset          = "auth.password_reset"
+	AuditEmailChanged           = "auth.email_changed"
+	AuditEmailReverted          = "auth.email_reverted"
+
+	AuditTodoCreate          = "todo.create"
+	AuditTodoUpdate          = "todo.update"
+	AuditTodoDelete          = "todo.delete"
+	AuditTodoRestore         = "todo.restore"
+	AuditTodoPurge           = "todo.purge"
+	AuditTodoMove            = "todo.move"
+	AuditTodoMoveToList      = "todo.move_to_list"
+	AuditTodoComplete        = "todo.complete"
+	AuditTodoRevisionRestore = "todo.revision_restore"
+	AuditTodoAttach          = "todo.attach"
+	AuditTodoDetach          = "todo.detach"
+
+	AuditColorCreate = "color.create"
+	AuditColorUpdate = "color.update"
+	AuditColorDelete = "color.delete"
+
+	AuditUserUpdate           = "user.update"
+	AuditPasswordChange       = "user.password_change"
+	AuditPreferencesUpdate    = "user.preferences_update"
+	AuditDeletionScheduled    = "user.deletion_scheduled"
+	AuditEmailChangeRequested = "user.email_change_requested"
+)
+
+// Types of the targets of audit log entries
+const (
+	AuditTargetUser  = "user"
+	AuditTargetTodo  = "todo"
+	AuditTargetColor = "color"
+)
+
+// UserRoleAdmin is the role of users who may read the audit log of everyone
+const UserRoleAdmin = "admin"
+
+var ErrAuditLogAppendOnly = errors.New("audit log entries can't be changed")
+
+// AuditLog is an entry of the append-only log of security and data events. It
+// keeps no foreign keys, so entries outlive the users and data they are about.
+type AuditLog struct {
+	ID         int          `gorm:"primary_key:auto_increment" json:"id"`
+	ActorID    *int         `gorm:"index" json:"actorId"`
+	Action     string       `gorm:"not null;index" json:"action"`
+	TargetType string       `gorm:"index:idx_audit_log_target" json:"targetType,omitempty"`
+	TargetID   *int         `gorm:"index:idx_audit_log_target" json:"targetId,omitempty"`
+	IP         string       `json:"ip"`
+	UserAgent  string       `json:"userAgent"`
+	Changes    FieldChanges `gorm:"type:text" json:"changes,omitempty"`
+	CreatedAt  time.Time    `gorm:"autoCreateTime;index; <-:create" json:"createdAt"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+func (AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func (AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+// AuditLogFilter narrows the entries returned by a query of the audit log.
+// Entries come newest first, BeforeID pages through older ones.
+type AuditLogFilter struct {
+	ActorID    *int       `form:"actorId"`
+	Action     string     `form:"action"`
+	TargetType string     `form:"targetType"`
+	TargetID   *int       `form:"targetId"`
+	From       *time.Time `form:"from"`
+	To         *time.Time `form:"to"`
+	BeforeID   int        `form:"beforeId"`
+	Limit      int        `form:"limit" binding:"omitempty,min=1,max=500"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailChange is a requested change of a user's email. It applies once confirmed
+// from the new address, and the old address can revert it until RevertExpiresAt.
+type EmailChange struct {
+	ID              int        `gorm:"primary_key:auto_increment" json:"id"`
+	OldEmail        string     `gorm:"not null" json:"oldEmail"`
+	NewEmail        string     `gorm:"not null" json:"newEmail"`
+	ConfirmToken    string     `gorm:"index" json:"-"`
+	RevertToken     string     `gorm:"index" json:"-"`
+	ExpiresAt       time.Time  `json:"expiresAt"`
+	RevertExpiresAt time.Time  `json:"revertExpiresAt"`
+	ConfirmedAt     *time.Time `json:"confirmedAt"`
+	RevertedAt      *time.Time `json:"revertedAt"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UserID          int        `gorm:"not null;index" json:"userId"`
+	User            User       `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (EmailChange) TableName() string {
+	return "email_change"
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ExportFormatJSON     = "json"
+	ExportFormatCSV      = "csv"
+	ExportFormatMarkdown = "markdown"
+	ExportFormatICS      = "ics"
+
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// Export is a zip archive of a user's data, built in the background. It can be
+// downloaded with the token sent by email until it expires.
+type Export struct {
+	ID             int        `gorm:"primary_key:auto_increment" json:"id"`
+	Formats        string     `gorm:"not null" json:"formats"`
+	IncludeDeleted bool       `gorm:"not null;default:false" json:"includeDeleted"`
+	Status         string     `gorm:"not null;index" json:"status"`
+	Error          string     `gorm:"text" json:"error,omitempty"`
+	Size           int64      `gorm:"not null;default:0" json:"size"`
+	Path           string     `gorm:"text" json:"-"`
+	Token          string     `gorm:"index" json:"-"`
+	ExpiresAt      *time.Time `gorm:"index" json:"expiresAt"`
+	StartedAt      *time.Time `json:"startedAt"`
+	FinishedAt     *time.Time `json:"finishedAt"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UpdatedAt      *time.Time `gorm:"autoUpdateTime; <-:update" json:"updatedAt"`
+	UserID         int        `gorm:"not null;index" json:"userId"`
+	User           User       `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (Export) TableName() string {
+	return "export"
+}
+
+type ExportInput struct {
+	Formats        []string `json:"formats" binding:"required,min=1,max=4,dive,oneof=json csv markdown ics"`
+	IncludeDeleted bool     `json:"includeDeleted"`
+}
+
+// ExportTag is a tag with the number of todos carrying it
+type ExportTag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// MagicLink is a one-time login link sent by email. Links bound to a device
+// only work in the browser holding the secret whose hash is DeviceHash.
+type MagicLink struct {
+	ID         int        `gorm:"primary_key:auto_increment" json:"id"`
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"`
+	DeviceHash string     `json:"-"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expiresAt"`
+	UsedAt     *time.Time `json:"usedAt"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UserID     int        `gorm:"not null;index" json:"userId"`
+	User       User       `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (MagicLink) TableName() string {
+	return "magic_link"
+}
+
+// 👈 MagicLinkInput struct
+type MagicLinkInput struct {
+	Email      string `json:"email" binding:"required"`
+	SameDevice bool   `json:"sameDevice"`
+}
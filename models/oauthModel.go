@@ -0,0 +1,150 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuthScopes are the scopes third-party apps can request, a subset of the
+// access token scopes
+var OAuthScopes = []string{"todo:read", "todo:write", "color:read", "color:write"}
+
+// OAuthScopeDescriptions are shown to the user on the consent page
+var OAuthScopeDescriptions = map[string]string{
+	"todo:read":   "See your todos",
+	"todo:write":  "Create, change and delete your todos",
+	"color:read":  "See the colors",
+	"color:write": "Create, change and delete colors",
+}
+
+// OAuthClient is a third-party app registered by a developer. Public clients,
+// such as mobile apps, have no secret and rely on PKCE alone.
+type OAuthClient struct {
+	ID           int       `gorm:"primary_key:auto_increment" json:"id"`
+	ClientID     string    `gorm:"uniqueIndex;not null" json:"clientId"`
+	SecretHash   string    `json:"-"`
+	Name         string    `gorm:"not null" json:"name"`
+	RedirectURIs Tags      `gorm:"type:text" json:"redirectUris"`
+	Scopes       Scopes    `gorm:"type:text" json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UserID       int       `gorm:"not null;index" json:"userId"`
+	User         User      `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (OAuthClient) TableName() string {
+	return "oauth_client"
+}
+
+// AllowsRedirect tells whether the client registered the redirect URI
+func (c OAuthClient) AllowsRedirect(uri string) bool {
+	for _, registered := range c.RedirectURIs {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// OAuthCode is an authorization code waiting to be exchanged for tokens
+type OAuthCode struct {
+	ID            int         `gorm:"primary_key:auto_increment" json:"id"`
+	CodeHash      string      `gorm:"uniqueIndex;not null" json:"-"`
+	RedirectURI   string      `gorm:"not null" json:"redirectUri"`
+	Scopes        Scopes      `gorm:"type:text" json:"scopes"`
+	CodeChallenge string      `gorm:"not null" json:"-"`
+	ExpiresAt     time.Time   `gorm:"index" json:"expiresAt"`
+	CreatedAt     time.Time   `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	ClientID      int         `gorm:"not null;index" json:"clientId"`
+	Client        OAuthClient `gorm:"foreignkey:ClientID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+	UserID        int         `gorm:"not null;index" json:"userId"`
+	User          User        `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (OAuthCode) TableName() string {
+	return "oauth_code"
+}
+
+// OAuthGrant is the access a user gave to a client. It holds the current
+// refresh token, which is replaced on every refresh, and the access tokens
+// issued for it stop working once it's revoked.
+type OAuthGrant struct {
+	ID               int         `gorm:"primary_key:auto_increment" json:"id"`
+	Scopes           Scopes      `gorm:"type:text" json:"scopes"`
+	RefreshTokenHash string      `gorm:"uniqueIndex;not null" json:"-"`
+	RefreshExpiresAt time.Time   `json:"refreshExpiresAt"`
+	RevokedAt        *time.Time  `gorm:"index" json:"revokedAt"`
+	LastUsedAt       *time.Time  `json:"lastUsedAt"`
+	CreatedAt        time.Time   `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	ClientID         int         `gorm:"not null;index" json:"clientId"`
+	Client           OAuthClient `gorm:"foreignkey:ClientID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"client"`
+	UserID           int         `gorm:"not null;index" json:"userId"`
+	User             User        `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (OAuthGrant) TableName() string {
+	return "oauth_grant"
+}
+
+type OAuthClientInput struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	RedirectURIs []string `json:"redirectUris" binding:"required,min=1,dive,url"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,oneof=todo:read todo:write color:read color:write"`
+	Confidential bool     `json:"confidential"`
+}
+
+// OAuthClientCreated carries the client secret, which can't be retrieved later
+type OAuthClientCreated struct {
+	ClientSecret string      `json:"clientSecret,omitempty"`
+	Client       OAuthClient `json:"client"`
+}
+
+// OAuthAuthorizeInput is the authorization request of a client
+type OAuthAuthorizeInput struct {
+	ResponseType        string `form:"response_type" binding:"required"`
+	ClientID            string `form:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope"`
+	State               string `form:"state"`
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
+}
+
+// OAuthConsentInput is the answer of the user on the consent page
+type OAuthConsentInput struct {
+	OAuthAuthorizeInput
+	Consent  string `form:"consent" binding:"required"`
+	Decision string `form:"decision" binding:"required,oneof=allow deny"`
+}
+
+// OAuthTokenInput is a request to the token endpoint. Clients may send their
+// credentials in the form instead of with basic auth.
+type OAuthTokenInput struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	Scope        string `form:"scope"`
+	ClientID     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// OAuthTokenResponse follows RFC 6749 section 5.1
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection follows RFC 7662 section 2.2
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	KeyPurposeAccess  = "access"
+	KeyPurposeRefresh = "refresh"
+)
+
+// SigningKey is an RSA key tokens are signed with. The newest key whose
+// ActivatesAt has passed signs new tokens, the older ones keep verifying the
+// tokens they signed until they are retired.
+type SigningKey struct {
+	ID          int        `gorm:"primary_key:auto_increment" json:"id"`
+	Kid         string     `gorm:"uniqueIndex;not null" json:"kid"`
+	Purpose     string     `gorm:"not null;index" json:"purpose"`
+	PrivateKey  string     `gorm:"type:text;not null" json:"-"`
+	ActivatesAt time.Time  `json:"activatesAt"`
+	RetiredAt   *time.Time `gorm:"index" json:"retiredAt"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+}
+
+func (SigningKey) TableName() string {
+	return "signing_key"
+}
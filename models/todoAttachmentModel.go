@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// TodoAttachment is a file attached to a todo, kept in the blob storage. When
+// the todo or the uploader is purged the row stays behind without them, until
+// the blobs are deleted along with it.
+type TodoAttachment struct {
+	ID           int       `gorm:"primary_key:auto_increment" json:"id"`
+	TodoID       *int      `gorm:"index" json:"todoId"`
+	Todo         *Todo     `gorm:"foreignkey:TodoID;constraint:onUpdate:CASCADE,onDelete:SET NULL" json:"-"`
+	Name         string    `gorm:"not null" json:"name"`
+	ContentType  string    `gorm:"not null" json:"contentType"`
+	Size         int64     `gorm:"not null" json:"size"`
+	StorageKey   string    `gorm:"not null;uniqueIndex" json:"-"`
+	ThumbnailKey string    `json:"-"`
+	UserID       *int      `gorm:"index" json:"userId"`
+	User         *User     `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:SET NULL" json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+
+	// Signed links to the file and its thumbnail, valid until URLExpiresAt
+	URL          string     `gorm:"-" json:"url"`
+	ThumbnailURL string     `gorm:"-" json:"thumbnailUrl,omitempty"`
+	URLExpiresAt *time.Time `gorm:"-" json:"urlExpiresAt"`
+}
+
+func (TodoAttachment) TableName() string {
+	return "todo_attachment"
+}
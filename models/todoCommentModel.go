@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// TodoComment is a message of the discussion thread of a todo. The body is
+// markdown, rendered by the clients.
+type TodoComment struct {
+	ID        int        `gorm:"primary_key:auto_increment" json:"id"`
+	TodoID    int        `gorm:"not null;index" json:"todoId"`
+	Todo      Todo       `gorm:"foreignkey:TodoID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+	Body      string     `gorm:"text;not null" json:"body"`
+	UserID    int        `gorm:"not null;index" json:"userId"`
+	User      User       `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+	Author    string     `gorm:"-" json:"author"`
+	CreatedAt time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	EditedAt  *time.Time `json:"editedAt"`
+}
+
+func (TodoComment) TableName() string {
+	return "todo_comment"
+}
+
+type TodoCommentInput struct {
+	Body string `json:"body" binding:"required,max=10000"`
+}
+
+// TodoCommentQuery pages through the comments of a todo, oldest first
+type TodoCommentQuery struct {
+	AfterID int `form:"afterId"`
+	Limit   int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+const (
+	ImportFormatICS     = "ics"
+	ImportFormatCSV     = "csv"
+	ImportFormatTodoTxt = "todotxt"
+
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// TodoImport is a background job importing todos from a file. A dry run only
+// parses and validates the rows and keeps a preview of what would be created.
+type TodoImport struct {
+	ID         int               `gorm:"primary_key:auto_increment" json:"id"`
+	Format     string            `gorm:"not null" json:"format"`
+	Filename   string            `gorm:"text" json:"filename"`
+	DryRun     bool              `gorm:"not null;default:false" json:"dryRun"`
+	Status     string            `gorm:"not null;index" json:"status"`
+	Total      int               `gorm:"not null;default:0" json:"total"`
+	Processed  int               `gorm:"not null;default:0" json:"processed"`
+	Imported   int               `gorm:"not null;default:0" json:"imported"`
+	Skipped    int               `gorm:"not null;default:0" json:"skipped"`
+	Failed     int               `gorm:"not null;default:0" json:"failed"`
+	Errors     TodoImportErrors  `gorm:"type:text" json:"errors"`
+	Preview    TodoImportPreview `gorm:"type:text" json:"preview,omitempty"`
+	Content    string            `gorm:"type:text" json:"-"`
+	Mapping    TodoImportMapping `gorm:"type:text" json:"mapping,omitempty"`
+	TodoListID *int              `json:"todoListId"`
+	StartedAt  *time.Time        `json:"startedAt"`
+	FinishedAt *time.Time        `json:"finishedAt"`
+	CreatedAt  time.Time         `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UpdatedAt  *time.Time        `gorm:"autoUpdateTime; <-:update" json:"updatedAt"`
+	UserID     int               `gorm:"not null;index" json:"userId"`
+	User       User              `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (TodoImport) TableName() string {
+	return "todo_import"
+}
+
+// TodoImportError reports why a row of the file was not imported. Rows are
+// counted from 1, the CSV header and iCalendar components included.
+type TodoImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type TodoImportErrors []TodoImportError
+
+func (e TodoImportErrors) Value() (driver.Value, error) {
+	return valueJSON(e)
+}
+
+func (e *TodoImportErrors) Scan(value interface{}) error {
+	return scanJSON(value, e)
+}
+
+type TodoImportPreview []TodoInput
+
+func (p TodoImportPreview) Value() (driver.Value, error) {
+	return valueJSON(p)
+}
+
+func (p *TodoImportPreview) Scan(value interface{}) error {
+	return scanJSON(value, p)
+}
+
+// TodoImportMapping maps CSV column headers onto todo fields: title, isi, reminder,
+// due, dueTimezone, color, tags and recurrence
+type TodoImportMapping map[string]string
+
+func (m TodoImportMapping) Value() (driver.Value, error) {
+	return valueJSON(m)
+}
+
+func (m *TodoImportMapping) Scan(value interface{}) error {
+	return scanJSON(value, m)
+}
+
+type TodoImportInput struct {
+	Format     string `form:"format" binding:"omitempty,oneof=ics csv todotxt"`
+	DryRun     bool   `form:"dryRun"`
+	Mapping    string `form:"mapping"`
+	TodoListID *int   `form:"todoListId"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TodoList struct {
+	ID        int            `gorm:"primary_key:auto_increment" json:"id"`
+	Name      string         `gorm:"text;not null" json:"name"`
+	Archived  bool           `gorm:"not null;default:false" json:"archived"`
+	Position  string         `gorm:"index;not null;default:''" json:"position"`
+	CreatedAt time.Time      `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UpdatedAt *time.Time     `gorm:"autoUpdateTime; <-:update" json:"updatedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleteAt"`
+	ColorID   *int           `json:"-"`
+	Color     *Color         `gorm:"foreignkey:ColorID;constraint:onUpdate:CASCADE,onDelete:SET NULL" json:"color"`
+	UserID    int            `gorm:"not null" json:"userId"`
+	User      User           `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (TodoList) TableName() string {
+	return "todo_list"
+}
+
+type TodoListInput struct {
+	Name     string `json:"name" form:"name" binding:"required"`
+	Archived bool   `json:"archived" form:"archived"`
+	ColorID  *int   `json:"colorId,omitempty" form:"colorId,omitempty"`
+	UserID   int    `json:"userId" form:"userId"`
+}
+
+// TodoListDeleteInput tells what happens to the todos of a deleted list: they are
+// either moved to another list (or out of any list when TargetID is empty) or trashed
+type TodoListDeleteInput struct {
+	Todos    string `form:"todos" binding:"required,oneof=move trash"`
+	TargetID *int   `form:"targetId"`
+}
+
+type TodoListMoveInput struct {
+	TodoListID *int `json:"todoListId"`
+}
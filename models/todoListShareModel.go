@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Roles a user can hold on a todo list, from least to most privileged
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+const (
+	SharePending  = "pending"
+	ShareAccepted = "accepted"
+	ShareDeclined = "declined"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// RoleAtLeast reports whether role grants everything required does.
+// The empty role means no access at all.
+func RoleAtLeast(role string, required string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[required]
+}
+
+type TodoListShare struct {
+	ID          int        `gorm:"primary_key:auto_increment" json:"id"`
+	TodoListID  int        `gorm:"not null;uniqueIndex:idx_todo_list_share_user" json:"todoListId"`
+	TodoList    *TodoList  `gorm:"foreignkey:TodoListID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"todoList,omitempty"`
+	UserID      int        `gorm:"not null;uniqueIndex:idx_todo_list_share_user" json:"userId"`
+	User        User       `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+	Email       string     `gorm:"text" json:"email"`
+	Role        string     `gorm:"not null" json:"role"`
+	Status      string     `gorm:"not null;default:pending" json:"status"`
+	Token       string     `gorm:"index" json:"-"`
+	InvitedByID int        `json:"invitedById"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UpdatedAt   *time.Time `gorm:"autoUpdateTime; <-:update" json:"updatedAt"`
+}
+
+func (TodoListShare) TableName() string {
+	return "todo_list_share"
+}
+
+type TodoListShareInput struct {
+	Email string `json:"email" binding:"required"`
+	Role  string `json:"role" binding:"required,oneof=viewer editor owner"`
+}
+
+type TodoListShareRoleInput struct {
+	Role string `json:"role" binding:"required,oneof=viewer editor owner"`
+}
@@ -10,17 +10,31 @@ import (
 )
 
 type Todo struct {
-	ID        int            `gorm:"primary_key:auto_increment" json:"id"`
-	Title     string         `gorm:"text" json:"title"`
-	Isi       string         `gorm:"text" json:"isi"`
-	Reminder  *time.Time     `json:"reminder"`
-	CreatedAt time.Time      `gorm:"autoCreateTime; <-:create" json:"createdAt"`
-	UpdatedAt *time.Time     `gorm:"autoUpdateTime; <-:update" json:"updatedAt"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleteAt"`
-	ColorID   *int           `json:"-"`
-	Color     *Color         `gorm:"foreignkey:ColorID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"color"`
-	UserID    int            `gorm:"not null" json:"userId"`
-	User      User           `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+	ID              int            `gorm:"primary_key:auto_increment" json:"id"`
+	Title           string         `gorm:"text" json:"title"`
+	Isi             string         `gorm:"text" json:"isi"`
+	Tags            Tags           `gorm:"type:text" json:"tags"`
+	Reminder        *time.Time     `json:"reminder"`
+	DueDate         *time.Time     `gorm:"index" json:"dueDate"`
+	DueAllDay       bool           `gorm:"not null;default:false" json:"dueAllDay"`
+	DueTimezone     string         `gorm:"text" json:"dueTimezone"`
+	Reminders       []TodoReminder `gorm:"foreignkey:TodoID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"reminders"`
+	Completed       bool           `gorm:"not null;default:false" json:"completed"`
+	CompletedAt     *time.Time     `json:"completedAt"`
+	Position        string         `gorm:"index;not null;default:''" json:"position"`
+	Recurrence      string         `gorm:"text" json:"recurrence"`
+	RecurrenceStart *time.Time     `json:"recurrenceStart"`
+	OccurrenceAt    *time.Time     `json:"occurrenceAt"`
+	OccurrenceIndex int            `gorm:"not null;default:0" json:"occurrenceIndex"`
+	CreatedAt       time.Time      `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UpdatedAt       *time.Time     `gorm:"autoUpdateTime; <-:update" json:"updatedAt"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleteAt"`
+	ColorID         *int           `json:"-"`
+	Color           *Color         `gorm:"foreignkey:ColorID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"color"`
+	UserID          int            `gorm:"not null" json:"userId"`
+	User            User           `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+	TodoListID      *int           `gorm:"index" json:"todoListId"`
+	TodoList        *TodoList      `gorm:"foreignkey:TodoListID;constraint:onUpdate:CASCADE,onDelete:SET NULL" json:"-"`
 }
 
 func (Todo) TableName() string {
@@ -28,9 +42,64 @@ func (Todo) TableName() string {
 }
 
 type TodoInput struct {
-	Title    string     `json:"title" form:"title" binding:"required"`
-	Isi      string     `json:"isi" form:"title" binding:"required"`
-	Reminder *time.Time `json:"reminder,omitempty" form:"reminder,omitempty"`
-	ColorID  *int       `json:"colorId,omitempty"  form:"colorId,omitempty"`
-	UserID   int        `json:"userId"  form:"userId"`
+	Title          string              `json:"title" form:"title" binding:"required"`
+	Isi            string              `json:"isi" form:"title" binding:"required"`
+	Tags           Tags                `json:"tags,omitempty" form:"tags,omitempty" binding:"omitempty,max=20,dive,max=50"`
+	Reminder       *time.Time          `json:"reminder,omitempty" form:"reminder,omitempty"`
+	ColorID        *int                `json:"colorId,omitempty"  form:"colorId,omitempty"`
+	TodoListID     *int                `json:"todoListId,omitempty"  form:"todoListId,omitempty"`
+	Recurrence     string              `json:"recurrence,omitempty"  form:"recurrence,omitempty"`
+	Due            string              `json:"due,omitempty"  form:"due,omitempty"`
+	DueTimezone    string              `json:"dueTimezone,omitempty"  form:"dueTimezone,omitempty"`
+	ReminderInputs []TodoReminderInput `json:"reminders,omitempty" binding:"omitempty,max=20,dive"`
+	UserID         int                 `json:"userId"  form:"userId"`
+	// DefaultColorID is the color of the creator's preferences, used when no
+	// color is given and it still exists
+	DefaultColorID *int `json:"-" form:"-"`
+}
+
+// SmartListQuery selects the day boundaries smart lists are computed with
+type SmartListQuery struct {
+	Timezone string `form:"tz"`
+	Days     int    `form:"days" binding:"omitempty,min=1,max=365"`
+}
+
+// TodoFilter narrows the todos returned by a listing
+type TodoFilter struct {
+	TodoListID *int `form:"todoListId"`
+}
+
+type TodoBulkInput struct {
+	IDs        []int      `json:"ids" binding:"required,min=1,max=500"`
+	Operation  string     `json:"operation" binding:"required,oneof=delete restore setColor setReminder complete moveToList"`
+	ColorID    *int       `json:"colorId,omitempty"`
+	Reminder   *time.Time `json:"reminder,omitempty"`
+	TodoListID *int       `json:"todoListId,omitempty"`
+}
+
+type TodoBulkResult struct {
+	ID      int    `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Before and After are the changed todo for the audit log, After is nil
+	// once it is deleted
+	Before *Todo `json:"-"`
+	After  *Todo `json:"-"`
+}
+
+type MoveInput struct {
+	BeforeID *int `json:"beforeId,omitempty"`
+	AfterID  *int `json:"afterId,omitempty"`
+}
+
+// TodoOccurrence is one upcoming occurrence of a recurring todo
+type TodoOccurrence struct {
+	Index        int        `json:"index"`
+	OccurrenceAt time.Time  `json:"occurrenceAt"`
+	Reminder     *time.Time `json:"reminder"`
+}
+
+type TodoCompleteResult struct {
+	Todo Todo  `json:"todo"`
+	Next *Todo `json:"next"`
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// TodoReminder is either an absolute time or an offset in minutes from the due
+// date of its todo, negative offsets being before it. RemindAt holds the resolved
+// time and is empty for offsets while the todo has no due date.
+type TodoReminder struct {
+	ID            int        `gorm:"primary_key:auto_increment" json:"id"`
+	TodoID        int        `gorm:"not null;index" json:"todoId"`
+	At            *time.Time `json:"at"`
+	OffsetMinutes *int       `json:"offsetMinutes"`
+	RemindAt      *time.Time `gorm:"index" json:"remindAt"`
+	SentAt        *time.Time `json:"sentAt"`
+	Attempts      int        `gorm:"not null;default:0" json:"-"`
+	Error         string     `gorm:"text" json:"error,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+}
+
+func (TodoReminder) TableName() string {
+	return "todo_reminder"
+}
+
+type TodoReminderInput struct {
+	At            *time.Time `json:"at,omitempty"`
+	OffsetMinutes *int       `json:"offsetMinutes,omitempty"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// TodoSnapshot is the state of a todo a revision keeps
+type TodoSnapshot struct {
+	Title       string     `gorm:"text" json:"title"`
+	Isi         string     `gorm:"text" json:"isi"`
+	Tags        Tags       `gorm:"type:text" json:"tags"`
+	Reminder    *time.Time `json:"reminder"`
+	DueDate     *time.Time `json:"dueDate"`
+	DueAllDay   bool       `gorm:"not null;default:false" json:"dueAllDay"`
+	DueTimezone string     `gorm:"text" json:"dueTimezone"`
+	Recurrence  string     `gorm:"text" json:"recurrence"`
+	Completed   bool       `gorm:"not null;default:false" json:"completed"`
+	ColorID     *int       `json:"colorId"`
+	TodoListID  *int       `json:"todoListId"`
+}
+
+// Snapshot is the state of the todo a revision keeps
+func (t Todo) Snapshot() TodoSnapshot {
+	return TodoSnapshot{
+		Title:       t.Title,
+		Isi:         t.Isi,
+		Tags:        t.Tags,
+		Reminder:    t.Reminder,
+		DueDate:     t.DueDate,
+		DueAllDay:   t.DueAllDay,
+		DueTimezone: t.DueTimezone,
+		Recurrence:  t.Recurrence,
+		Completed:   t.Completed,
+		ColorID:     t.ColorID,
+		TodoListID:  t.TodoListID,
+	}
+}
+
+// TodoRevision is the state of a todo after one of its changes. Revisions are
+// numbered from 1 per todo. Changes made before revisions were kept, or by
+// something else than a user, have no author.
+type TodoRevision struct {
+	ID     int  `gorm:"primary_key:auto_increment" json:"id"`
+	TodoID int  `gorm:"not null;uniqueIndex:idx_todo_revision_number" json:"todoId"`
+	Todo   Todo `gorm:"foreignkey:TodoID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+	Number int  `gorm:"not null;uniqueIndex:idx_todo_revision_number" json:"number"`
+	TodoSnapshot
+	AuthorID  *int      `gorm:"index" json:"authorId"`
+	Author    *User     `gorm:"foreignkey:AuthorID;constraint:onUpdate:CASCADE,onDelete:SET NULL" json:"-"`
+	CreatedAt time.Time `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+}
+
+func (TodoRevision) TableName() string {
+	return "todo_revision"
+}
+
+// TodoRevisionDiffQuery selects the two revisions to compare
+type TodoRevisionDiffQuery struct {
+	From int `form:"from" binding:"required,min=1"`
+	To   int `form:"to" binding:"required,min=1"`
+}
+
+// TodoRevisionDiff lists the fields that differ between two revisions
+type TodoRevisionDiff struct {
+	From    int          `json:"from"`
+	To      int          `json:"to"`
+	Changes FieldChanges `json:"changes"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Tags is a list of labels, stored as a JSON array
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	return valueJSON(t)
+}
+
+func (t *Tags) Scan(value interface{}) error {
+	return scanJSON(value, t)
+}
+
+// FieldChange is the value of a field before and after a change, nil when the
+// object didn't exist
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// FieldChanges are the changed fields of an object, stored as a JSON object
+type FieldChanges map[string]FieldChange
+
+func (c FieldChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	return valueJSON(c)
+}
+
+func (c *FieldChanges) Scan(value interface{}) error {
+	return scanJSON(value, c)
+}
+
+func valueJSON(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func scanJSON(value interface{}, v interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	case []byte:
+		return json.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", value, v)
+	}
+}
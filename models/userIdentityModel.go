@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an OpenID Connect provider
+type UserIdentity struct {
+	ID          int        `gorm:"primary_key:auto_increment" json:"id"`
+	Provider    string     `gorm:"not null;uniqueIndex:idx_identity_subject;uniqueIndex:idx_identity_user" json:"provider"`
+	Subject     string     `gorm:"not null;uniqueIndex:idx_identity_subject" json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+	UserID      int        `gorm:"not null;uniqueIndex:idx_identity_user" json:"userId"`
+	User        User       `gorm:"foreignkey:UserID;constraint:onUpdate:CASCADE,onDelete:CASCADE" json:"-"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identity"
+}
+
+// OIDCLogin is a login started with a provider, waiting for the user to come
+// back with an authorization code. UserID is set when a logged in user links
+// the provider to their account.
+type OIDCLogin struct {
+	ID           int       `gorm:"primary_key:auto_increment" json:"id"`
+	State        string    `gorm:"uniqueIndex;not null" json:"-"`
+	Provider     string    `gorm:"not null" json:"provider"`
+	Nonce        string    `gorm:"not null" json:"-"`
+	CodeVerifier string    `gorm:"not null" json:"-"`
+	UserID       *int      `json:"userId"`
+	ExpiresAt    time.Time `gorm:"index" json:"expiresAt"`
+	CreatedAt    time.Time `gorm:"autoCreateTime; <-:create" json:"createdAt"`
+}
+
+func (OIDCLogin) TableName() string {
+	return "oidc_login"
+}
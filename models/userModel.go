@@ -5,22 +5,69 @@ import (
 )
 
 type User struct {
-	ID                 int       `json:"id,omitempty" bson:"_id,omitempty"`
-	Name               string    `json:"name,omitempty" bson:"name,omitempty"`
-	Email              string    `json:"email,omitempty" bson:"email,omitempty"`
-	Password           string    `json:"password" bson:"password" binding:"required,min=8"`
-	VerificationCode   string    `json:"verificationCode,omitempty" bson:"verificationCode"`
-	PasswordResetToken string    `json:"passwordResetToken,omitempty" bson:"passwordResetToken,omitempty"`
-	Role               string    `json:"role,omitempty" bson:"role,omitempty"`
-	Verified           bool      `json:"verified" bson:"verified"`
-	CreatedAt          time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at" bson:"updated_at"`
+	ID                  int             `json:"id,omitempty" bson:"_id,omitempty"`
+	Name                string          `json:"name,omitempty" bson:"name,omitempty"`
+	Email               string          `gorm:"uniqueIndex" json:"email,omitempty" bson:"email,omitempty"`
+	Password            string          `json:"password" bson:"password" binding:"required,min=8"`
+	VerificationCode    string          `json:"verificationCode,omitempty" bson:"verificationCode"`
+	PasswordResetToken  string          `json:"passwordResetToken,omitempty" bson:"passwordResetToken,omitempty"`
+	Role                string          `json:"role,omitempty" bson:"role,omitempty"`
+	Avatar              string          `gorm:"text" json:"avatar,omitempty" bson:"avatar,omitempty"`
+	Verified            bool            `json:"verified" bson:"verified"`
+	Preferences         UserPreferences `gorm:"embedded;embeddedPrefix:pref_" json:"preferences" bson:"preferences"`
+	FeedToken           string          `gorm:"index" json:"-" bson:"feedToken,omitempty"`
+	DeletionScheduledAt *time.Time      `gorm:"index" json:"deletionScheduledAt,omitempty" bson:"deletionScheduledAt,omitempty"`
+	SessionsValidAfter  *time.Time      `json:"-" bson:"sessionsValidAfter,omitempty"`
+	CreatedAt           time.Time       `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at" bson:"updated_at"`
 }
 
 func (User) TableName() string {
 	return "user"
 }
 
+// 👈 UserPreferences struct
+type UserPreferences struct {
+	Timezone         string `gorm:"not null;default:UTC" json:"timezone"`
+	Locale           string `gorm:"not null;default:en" json:"locale"`
+	WeekStart        string `gorm:"not null;default:monday" json:"weekStart"`
+	DefaultColorID   *int   `json:"defaultColorId"`
+	EmailReminders   bool   `gorm:"not null;default:true" json:"emailReminders"`
+	EmailInvitations bool   `gorm:"not null;default:true" json:"emailInvitations"`
+	EmailMentions    bool   `gorm:"not null;default:true" json:"emailMentions"`
+}
+
+// Location is the timezone of the user, UTC when none or an unknown one is set
+func (p UserPreferences) Location() *time.Location {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// FirstWeekday is the day weeks start on for the user, monday unless set
+func (p UserPreferences) FirstWeekday() time.Weekday {
+	switch p.WeekStart {
+	case "sunday":
+		return time.Sunday
+	case "saturday":
+		return time.Saturday
+	}
+	return time.Monday
+}
+
+// 👈 UserPreferencesInput struct
+type UserPreferencesInput struct {
+	Timezone         string `json:"timezone" binding:"required"`
+	Locale           string `json:"locale" binding:"required,min=2,max=10"`
+	WeekStart        string `json:"weekStart" binding:"required,oneof=monday sunday saturday"`
+	DefaultColorID   *int   `json:"defaultColorId"`
+	EmailReminders   bool   `json:"emailReminders"`
+	EmailInvitations bool   `json:"emailInvitations"`
+	EmailMentions    bool   `json:"emailMentions"`
+}
+
 // 👈 SignUpInput struct
 type SignUpInput struct {
 	Name             string    `json:"name" bson:"name" binding:"required"`
@@ -42,12 +89,15 @@ type SignInInput struct {
 
 // 👈 UserResponse struct
 type UserResponse struct {
-	ID        int       `json:"id,omitempty" bson:"_id,omitempty"`
-	Name      string    `json:"name,omitempty" bson:"name,omitempty"`
-	Email     string    `json:"email,omitempty" bson:"email,omitempty"`
-	Role      string    `json:"role,omitempty" bson:"role,omitempty"`
-	CreatedAt time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+	ID                  int             `json:"id,omitempty" bson:"_id,omitempty"`
+	Name                string          `json:"name,omitempty" bson:"name,omitempty"`
+	Email               string          `json:"email,omitempty" bson:"email,omitempty"`
+	Role                string          `json:"role,omitempty" bson:"role,omitempty"`
+	Avatar              string          `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	Preferences         UserPreferences `json:"preferences" bson:"preferences"`
+	DeletionScheduledAt *time.Time      `json:"deletionScheduledAt,omitempty" bson:"deletionScheduledAt,omitempty"`
+	CreatedAt           time.Time       `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at" bson:"updated_at"`
 }
 
 // 👈 ForgotPasswordInput struct
@@ -66,17 +116,39 @@ type ResetPasswordInput struct {
 }
 
 type UserEdit struct {
-	Name     string `json:"name" bson:"name" binding:"required"`
-	Password string `json:"password" bson:"password" binding:"required,min=8"`
+	Name        string                `json:"name" bson:"name" binding:"required,max=100"`
+	Avatar      string                `json:"avatar" bson:"avatar" binding:"omitempty,url,max=2048"`
+	Preferences *UserPreferencesInput `json:"preferences,omitempty" bson:"preferences,omitempty"`
+}
+
+// 👈 ChangePasswordInput struct
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	Password        string `json:"password" binding:"required,min=8"`
+	PasswordConfirm string `json:"passwordConfirm" binding:"required,eqfield=Password"`
+}
+
+// 👈 ChangeEmailInput struct
+type ChangeEmailInput struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// 👈 DeleteAccountInput struct
+type DeleteAccountInput struct {
+	Password string `json:"password" binding:"required"`
 }
 
 func FilteredResponse(user *User) UserResponse {
 	return UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		Role:      user.Role,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:                  user.ID,
+		Email:               user.Email,
+		Name:                user.Name,
+		Role:                user.Role,
+		Avatar:              user.Avatar,
+		Preferences:         user.Preferences,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		CreatedAt:           user.CreatedAt,
+		UpdatedAt:           user.UpdatedAt,
 	}
 }
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"golang/controllers"
+	"golang/middleware"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccessTokenRouteController struct {
+	accessTokenController controllers.AccessTokenController
+}
+
+func NewRouteAccessTokenController(accessTokenController controllers.AccessTokenController) AccessTokenRouteController {
+	return AccessTokenRouteController{accessTokenController}
+}
+
+func (ac *AccessTokenRouteController) AccessTokenRoute(rg *gin.RouterGroup, userService services.UserService) {
+
+	router := rg.Group("token")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireSession())
+	router.GET("/list", ac.accessTokenController.List)
+	router.POST("/create", ac.accessTokenController.Insert)
+	router.DELETE("/delete/:id", ac.accessTokenController.Delete)
+}
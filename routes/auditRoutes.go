@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"golang/controllers"
+	"golang/middleware"
+	"golang/models"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditRouteController struct {
+	auditController controllers.AuditController
+}
+
+func NewRouteAuditController(auditController controllers.AuditController) AuditRouteController {
+	return AuditRouteController{auditController}
+}
+
+func (ac *AuditRouteController) AuditRoute(rg *gin.RouterGroup, userService services.UserService) {
+
+	router := rg.Group("audit")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireSession())
+	router.GET("/list", ac.auditController.List)
+	router.GET("/export", ac.auditController.Export)
+
+	admin := rg.Group("admin/audit")
+	admin.Use(middleware.DeserializeUser(userService), middleware.RequireSession(), middleware.RequireRole(models.UserRoleAdmin))
+	admin.GET("/list", ac.auditController.AdminList)
+	admin.GET("/export", ac.auditController.AdminExport)
+}
@@ -22,10 +22,15 @@ func (rc *AuthRouteController) AuthRoute(rg *gin.RouterGroup, userService servic
 	router.POST("/register", rc.authController.SignUpUser)
 	router.POST("/resendverification", rc.authController.ResendVerification)
 	router.POST("/login", rc.authController.SignInUser)
+	router.POST("/magiclink", rc.authController.RequestMagicLink)
+	router.GET("/magiclink/:token", rc.authController.MagicLinkPage)
+	router.POST("/magiclink/:token", rc.authController.MagicLogin)
 	router.GET("/refresh", rc.authController.RefreshAccessToken)
 	router.GET("/logout", middleware.DeserializeUser(userService), rc.authController.LogoutUser)
 	router.GET("/verifyemail/:verificationCode", rc.authController.VerifyEmail)
 	router.POST("/forgotpassword", rc.authController.ForgotPassword)
 	router.POST("/resendforgotpassword", rc.authController.ResendForgotPassword)
 	router.PATCH("/resetpassword/:resetToken", rc.authController.ResetPassword)
+	router.POST("/confirmemail/:token", rc.authController.ConfirmEmail)
+	router.POST("/revertemail/:token", rc.authController.RevertEmail)
 }
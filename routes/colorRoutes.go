@@ -19,7 +19,7 @@ func NewRouteColorController(colorController controllers.ColorController) ColorR
 func (tc *ColorRouteController) ColorRoute(rg *gin.RouterGroup, userService services.UserService) {
 
 	router := rg.Group("color")
-	router.Use(middleware.DeserializeUser(userService))
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireScope("color"))
 	router.GET("/list", tc.colorController.List)
 	router.GET("/detail/:id", tc.colorController.FindByID)
 	router.POST("/create", tc.colorController.Insert)
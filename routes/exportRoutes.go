@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"golang/controllers"
+	"golang/middleware"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExportRouteController struct {
+	exportController controllers.ExportController
+}
+
+func NewRouteExportController(exportController controllers.ExportController) ExportRouteController {
+	return ExportRouteController{exportController}
+}
+
+func (ec *ExportRouteController) ExportRoute(rg *gin.RouterGroup, userService services.UserService) {
+
+	public := rg.Group("export")
+	public.GET("/download/:token", ec.exportController.Download)
+
+	router := rg.Group("export")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireScope("export"))
+	router.POST("/create", ec.exportController.Create)
+	router.GET("/detail/:id", ec.exportController.FindByID)
+}
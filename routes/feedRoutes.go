@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"golang/controllers"
+	"golang/middleware"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FeedRouteController struct {
+	feedController controllers.FeedController
+}
+
+func NewRouteFeedController(feedController controllers.FeedController) FeedRouteController {
+	return FeedRouteController{feedController}
+}
+
+func (fc *FeedRouteController) FeedRoute(rg *gin.RouterGroup, userService services.UserService) {
+
+	public := rg.Group("feed")
+	public.GET("/:token/todos.ics", fc.feedController.Calendar)
+
+	router := rg.Group("user/feed")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireSession())
+	router.POST("/regenerate", fc.feedController.Regenerate)
+	router.DELETE("", fc.feedController.Disable)
+}
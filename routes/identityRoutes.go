@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"golang/controllers"
+	"golang/middleware"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IdentityRouteController struct {
+	identityController controllers.IdentityController
+}
+
+func NewRouteIdentityController(identityController controllers.IdentityController) IdentityRouteController {
+	return IdentityRouteController{identityController}
+}
+
+func (ic *IdentityRouteController) IdentityRoute(rg *gin.RouterGroup, userService services.UserService) {
+
+	public := rg.Group("auth")
+	public.GET("/providers", ic.identityController.Providers)
+	public.GET("/oidc/:provider/login", ic.identityController.Login)
+	public.GET("/oidc/:provider/callback", ic.identityController.Callback)
+
+	router := rg.Group("user/identities")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireSession())
+	router.GET("", ic.identityController.List)
+	router.POST("/:provider", ic.identityController.Link)
+	router.DELETE("/:provider", ic.identityController.Unlink)
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"golang/controllers"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KeyRouteController struct {
+	keyController controllers.KeyController
+}
+
+func NewRouteKeyController(keyController controllers.KeyController) KeyRouteController {
+	return KeyRouteController{keyController}
+}
+
+// KeyRoute mounts the well-known endpoints at the root of the server, where
+// clients look them up
+func (kc *KeyRouteController) KeyRoute(rg *gin.RouterGroup) {
+	router := rg.Group("/.well-known")
+	router.GET("/jwks.json", kc.keyController.JWKS)
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"golang/controllers"
+	"golang/middleware"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthRouteController struct {
+	oauthController controllers.OAuthController
+}
+
+func NewRouteOAuthController(oauthController controllers.OAuthController) OAuthRouteController {
+	return OAuthRouteController{oauthController}
+}
+
+func (oc *OAuthRouteController) OAuthRoute(rg *gin.RouterGroup, userService services.UserService) {
+
+	// Clients authenticate on their own to these endpoints
+	public := rg.Group("oauth")
+	public.POST("/token", oc.oauthController.Token)
+	public.POST("/introspect", oc.oauthController.Introspect)
+	public.POST("/revoke", oc.oauthController.Revoke)
+
+	router := rg.Group("oauth")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireSession())
+	router.GET("/authorize", oc.oauthController.Authorize)
+	router.POST("/authorize", oc.oauthController.Consent)
+	router.GET("/clients", oc.oauthController.Clients)
+	router.POST("/clients", oc.oauthController.CreateClient)
+	router.DELETE("/clients/:id", oc.oauthController.DeleteClient)
+	router.GET("/grants", oc.oauthController.Grants)
+	router.DELETE("/grants/:id", oc.oauthController.RevokeGrant)
+}
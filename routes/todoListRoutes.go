@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"golang/controllers"
+	"golang/middleware"
+	"golang/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TodoListRouteController struct {
+	todoListController controllers.TodoListController
+}
+
+func NewRouteTodoListController(todoListController controllers.TodoListController) TodoListRouteController {
+	return TodoListRouteController{todoListController}
+}
+
+func (lc *TodoListRouteController) TodoListRoute(rg *gin.RouterGroup, userService services.UserService) {
+
+	router := rg.Group("todolist")
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireScope("todolist"))
+	router.GET("/list", lc.todoListController.List)
+	router.GET("/detail/:id", lc.todoListController.FindByID)
+	router.POST("/create", lc.todoListController.Insert)
+	router.PUT("/edit/:id", lc.todoListController.Update)
+	router.DELETE("/delete/:id", lc.todoListController.Delete)
+	router.PUT("/move/:id", lc.todoListController.Move)
+	router.GET("/shares/:id", lc.todoListController.Shares)
+	router.POST("/share/:id", lc.todoListController.Share)
+	router.PUT("/editshare/:id", lc.todoListController.UpdateShare)
+	router.DELETE("/unshare/:id", lc.todoListController.Unshare)
+	router.GET("/invitations", lc.todoListController.Invitations)
+	router.POST("/acceptinvitation/:invitationToken", lc.todoListController.AcceptInvitation)
+	router.POST("/declineinvitation/:invitationToken", lc.todoListController.DeclineInvitation)
+}
@@ -18,11 +18,38 @@ func NewRouteTodoController(todoController controllers.TodoController) TodoRoute
 
 func (tc *TodoRouteController) TodoRoute(rg *gin.RouterGroup, userService services.UserService) {
 
+	public := rg.Group("todo")
+	public.GET("/attachments/blob", tc.todoController.AttachmentBlob)
+
 	router := rg.Group("todo")
-	router.Use(middleware.DeserializeUser(userService))
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireScope("todo"))
 	router.GET("/list", tc.todoController.List)
 	router.GET("/detail/:id", tc.todoController.FindByID)
 	router.POST("/create", tc.todoController.Insert)
 	router.PUT("/edit/:id", tc.todoController.Update)
 	router.DELETE("/delete/:id", tc.todoController.Delete)
+	router.GET("/trash", tc.todoController.Trash)
+	router.PUT("/restore/:id", tc.todoController.Restore)
+	router.DELETE("/purge/:id", tc.todoController.Purge)
+	router.POST("/bulk", tc.todoController.Bulk)
+	router.PUT("/move/:id", tc.todoController.Move)
+	router.PUT("/movelist/:id", tc.todoController.MoveToList)
+	router.PUT("/complete/:id", tc.todoController.Complete)
+	router.GET("/occurrences/:id", tc.todoController.Occurrences)
+	router.GET("/today", tc.todoController.Today)
+	router.GET("/upcoming", tc.todoController.Upcoming)
+	router.GET("/overdue", tc.todoController.Overdue)
+	router.POST("/import", tc.todoController.Import)
+	router.GET("/import/:id", tc.todoController.FindImport)
+	router.GET("/revisions/:id", tc.todoController.Revisions)
+	router.GET("/revisions/:id/diff", tc.todoController.RevisionDiff)
+	router.PUT("/revisions/:id/restore/:number", tc.todoController.RestoreRevision)
+	router.GET("/:id/comments", tc.todoController.Comments)
+	router.POST("/:id/comments", tc.todoController.InsertComment)
+	router.PUT("/:id/comments/:commentId", tc.todoController.UpdateComment)
+	router.DELETE("/:id/comments/:commentId", tc.todoController.DeleteComment)
+	router.GET("/:id/attachments", tc.todoController.Attachments)
+	router.POST("/:id/attachments", tc.todoController.InsertAttachment)
+	router.GET("/:id/attachments/:attachmentId/download", tc.todoController.DownloadAttachment)
+	router.DELETE("/:id/attachments/:attachmentId", tc.todoController.DeleteAttachment)
 }
@@ -19,7 +19,12 @@ func NewRouteUserController(userController controllers.UserController) UserRoute
 func (uc *UserRouteController) UserRoute(rg *gin.RouterGroup, userService services.UserService) {
 
 	router := rg.Group("user")
-	router.Use(middleware.DeserializeUser(userService))
+	router.Use(middleware.DeserializeUser(userService), middleware.RequireScope("user"))
 	router.GET("/profile", uc.userController.Profile)
 	router.PUT("/edit", uc.userController.Update)
+	router.PUT("/password", middleware.RequireSession(), uc.userController.ChangePassword)
+	router.GET("/preferences", uc.userController.Preferences)
+	router.PUT("/preferences", uc.userController.UpdatePreferences)
+	router.DELETE("", middleware.RequireSession(), uc.userController.Delete)
+	router.POST("/email", middleware.RequireSession(), uc.userController.ChangeEmail)
 }
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"golang/models"
+	"golang/utils"
+
+	"github.com/thanhpk/randstr"
+	"gorm.io/gorm"
+)
+
+type AccessTokenService interface {
+	All(userID int) ([]*models.AccessToken, error)
+	Create(userID int, input models.AccessTokenInput) (models.AccessTokenCreated, error)
+	Revoke(tokenID int, userID int) error
+}
+
+var (
+	ErrAccessTokenNotFound = errors.New("access token not found")
+	ErrInvalidExpiry       = errors.New("expiry must be in the future")
+)
+
+// accessTokenTouchEvery throttles the writes tracking when a token was last used
+const accessTokenTouchEvery = time.Minute
+
+type accessTokenService struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenService(db *gorm.DB) AccessTokenService {
+	return &accessTokenService{db}
+}
+
+func (as *accessTokenService) All(userID int) ([]*models.AccessToken, error) {
+	var tokens []*models.AccessToken
+	err := as.db.Where("user_id = ?", userID).Order("id").Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (as *accessTokenService) Create(userID int, input models.AccessTokenInput) (models.AccessTokenCreated, error) {
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return models.AccessTokenCreated{}, ErrInvalidExpiry
+	}
+
+	token := models.AccessTokenPrefix + randstr.String(40)
+	accessToken := models.AccessToken{
+		Name:      input.Name,
+		Hint:      token[:len(models.AccessTokenPrefix)+4] + "…" + token[len(token)-4:],
+		TokenHash: utils.HashToken(token),
+		Scopes:    input.Scopes,
+		ExpiresAt: input.ExpiresAt,
+		UserID:    userID,
+	}
+	if err := as.db.Create(&accessToken).Error; err != nil {
+		return models.AccessTokenCreated{}, err
+	}
+	return models.AccessTokenCreated{Token: token, AccessToken: accessToken}, nil
+}
+
+func (as *accessTokenService) Revoke(tokenID int, userID int) error {
+	result := as.db.Where("id = ? AND user_id = ?", tokenID, userID).Delete(&models.AccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// findAccessToken returns the unexpired token matching the given secret and
+// records that it was used
+func findAccessToken(db *gorm.DB, token string) (*models.AccessToken, error) {
+	var accessToken models.AccessToken
+	err := db.Where("token_hash = ?", utils.HashToken(token)).First(&accessToken).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if accessToken.ExpiresAt != nil && accessToken.ExpiresAt.Before(now) {
+		return nil, ErrAccessTokenNotFound
+	}
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) > accessTokenTouchEvery {
+		if err := db.Model(&accessToken).Update("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &accessToken, nil
+}
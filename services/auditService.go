@@ -0,0 +1,253 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"golang/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditService interface {
+	Record(entry models.AuditLog, before interface{}, after interface{}) error
+	Find(filter models.AuditLogFilter, userID *int) ([]*models.AuditLog, error)
+	Export(w io.Writer, filter models.AuditLogFilter, userID *int) error
+}
+
+const defaultAuditLogLimit = 100
+
+// auditRedacted are the fields whose values never reach the audit log, only
+// the fact that they changed
+var auditRedacted = map[string]bool{
+	"password":           true,
+	"verificationCode":   true,
+	"passwordResetToken": true,
+}
+
+// auditPersonal are the fields of a user that are redacted from the entries
+// about them once their account is deleted
+var auditPersonal = map[string]bool{
+	"email":  true,
+	"name":   true,
+	"avatar": true,
+}
+
+type auditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) AuditService {
+	return &auditService{db}
+}
+
+// Record appends an entry with the fields that differ between the target before
+// and after the event. Either may be nil when the target was created or deleted.
+func (as *auditService) Record(entry models.AuditLog, before interface{}, after interface{}) error {
+	changes, err := changedFields(before, after)
+	if err != nil {
+		return err
+	}
+	entry.ID = 0
+	entry.Changes = changes
+	return as.db.Create(&entry).Error
+}
+
+// Find returns the entries of the filter, newest first. With a user, only the
+// events they did or that targeted their account are returned.
+func (as *auditService) Find(filter models.AuditLogFilter, userID *int) ([]*models.AuditLog, error) {
+	limit := filter.Limit
+	if limit == 0 {
+		limit = defaultAuditLogLimit
+	}
+
+	query := as.filter(filter, userID)
+	if filter.BeforeID != 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	var entries []*models.AuditLog
+	err := query.Order("id desc").Limit(limit).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Export writes every entry of the filter as JSON lines, oldest first
+func (as *auditService) Export(w io.Writer, filter models.AuditLogFilter, userID *int) error {
+	encoder := json.NewEncoder(w)
+	var batch []*models.AuditLog
+	return as.filter(filter, userID).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func (as *auditService) filter(filter models.AuditLogFilter, userID *int) *gorm.DB {
+	query := as.db.Model(&models.AuditLog{})
+	if userID != nil {
+		query = query.Where("actor_id = ? OR (target_type = ? AND target_id = ?)", *userID, models.AuditTargetUser, *userID)
+	} else if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// changedFields compares the JSON fields of an object before and after a change
+func changedFields(before interface{}, after interface{}) (models.FieldChanges, error) {
+	from, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := models.FieldChanges{}
+	for key, value := range from {
+		if !reflect.DeepEqual(value, to[key]) {
+			changes[key] = auditChange(key, value, to[key])
+		}
+	}
+	for key, value := range to {
+		if _, ok := from[key]; !ok && value != nil {
+			changes[key] = auditChange(key, nil, value)
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, nil
+}
+
+func auditFields(target interface{}) (map[string]interface{}, error) {
+	if target == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func auditChange(key string, from interface{}, to interface{}) models.FieldChange {
+	if auditRedacted[key] {
+		return models.FieldChange{From: redactedValue(from), To: redactedValue(to)}
+	}
+	return models.FieldChange{From: redactAudit(from), To: redactAudit(to)}
+}
+
+// redactAudit hides the redacted fields of nested objects, such as the user a
+// todo is preloaded with
+func redactAudit(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if auditRedacted[key] {
+				v[key] = redactedValue(child)
+			} else {
+				v[key] = redactAudit(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactAudit(child)
+		}
+	}
+	return value
+}
+
+// anonymizeAuditLog strips a deleted user from the audit log. The entries stay,
+// so the log still tells what happened, but no longer who did it or from where.
+// It runs UpdateColumn, which skips the hooks keeping the log append-only.
+func anonymizeAuditLog(tx *gorm.DB, user models.User) error {
+	about := "actor_id = ? OR (target_type = ? AND target_id = ?)"
+	values := map[string]bool{user.Email: user.Email != "", user.Name: user.Name != ""}
+
+	// Entries of others may show the user too, such as a todo of theirs with
+	// its creator preloaded
+	var batch []*models.AuditLog
+	err := tx.Where(about+" OR changes LIKE ?", user.ID, models.AuditTargetUser, user.ID, "%"+user.Email+"%").
+		Where("changes IS NOT NULL").
+		FindInBatches(&batch, 500, func(*gorm.DB, int) error {
+			for _, entry := range batch {
+				personal := entry.TargetType == models.AuditTargetUser && entry.TargetID != nil && *entry.TargetID == user.ID
+				changes := anonymizeChanges(entry.Changes, personal, values)
+				if err := tx.Model(entry).UpdateColumn("changes", changes).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&models.AuditLog{}).Where(about, user.ID, models.AuditTargetUser, user.ID).
+		UpdateColumns(map[string]interface{}{"actor_id": nil, "ip": "", "user_agent": ""}).Error
+}
+
+// anonymizeChanges redacts the strings among the values, anywhere in the
+// changes, and the personal fields of the changes of a user
+func anonymizeChanges(changes models.FieldChanges, personal bool, values map[string]bool) models.FieldChanges {
+	for key, change := range changes {
+		if personal && auditPersonal[key] {
+			changes[key] = models.FieldChange{From: redactedValue(change.From), To: redactedValue(change.To)}
+		} else {
+			changes[key] = models.FieldChange{From: anonymizeValue(change.From, values), To: anonymizeValue(change.To, values)}
+		}
+	}
+	return changes
+}
+
+func anonymizeValue(value interface{}, values map[string]bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if values[v] {
+			return redactedValue(v)
+		}
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = anonymizeValue(child, values)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = anonymizeValue(child, values)
+		}
+	}
+	return value
+}
+
+func redactedValue(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return value
+	}
+	return "[redacted]"
+}
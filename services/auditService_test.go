@@ -0,0 +1,54 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"golang/models"
+)
+
+func TestAnonymizeChanges(t *testing.T) {
+	values := map[string]bool{"alice@example.com": true, "Alice": true}
+
+	t.Run("entry about the user", func(t *testing.T) {
+		changes := models.FieldChanges{
+			"email":  {From: "old@example.com", To: "alice@example.com"},
+			"name":   {From: "", To: "Alice"},
+			"locale": {From: "en", To: "fr"},
+		}
+		want := models.FieldChanges{
+			"email":  {From: "[redacted]", To: "[redacted]"},
+			"name":   {From: "", To: "[redacted]"},
+			"locale": {From: "en", To: "fr"},
+		}
+		if got := anonymizeChanges(changes, true, values); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("entry about a todo", func(t *testing.T) {
+		changes := models.FieldChanges{
+			"title": {From: "Call Alice", To: "Alice"},
+			"name":  {From: nil, To: "Groceries"},
+			"user": {From: nil, To: map[string]interface{}{
+				"email": "alice@example.com",
+				"name":  "Alice",
+				"id":    float64(1),
+			}},
+			"tags": {From: nil, To: []interface{}{"Alice", "work"}},
+		}
+		want := models.FieldChanges{
+			"title": {From: "Call Alice", To: "[redacted]"},
+			"name":  {From: nil, To: "Groceries"},
+			"user": {From: nil, To: map[string]interface{}{
+				"email": "[redacted]",
+				"name":  "[redacted]",
+				"id":    float64(1),
+			}},
+			"tags": {From: nil, To: []interface{}{"[redacted]", "work"}},
+		}
+		if got := anonymizeChanges(changes, false, values); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
@@ -1,19 +1,29 @@
 package services
 
 import (
+	"crypto/subtle"
+	"errors"
 	"strings"
 	"time"
 
 	"golang/models"
 	"golang/utils"
 
+	"github.com/thanhpk/randstr"
 	"gorm.io/gorm"
 )
 
 type AuthService interface {
 	SignUpUser(*models.SignUpInput) (*models.User, error)
+	CreateMagicLink(userID int, sameDevice bool, expiresIn time.Duration) (string, string, error)
+	RedeemMagicLink(token string, deviceSecret string) (*models.User, error)
 }
 
+var (
+	ErrMagicLinkNotFound    = errors.New("login link not found, expired or already used")
+	ErrMagicLinkOtherDevice = errors.New("login link was requested from another device")
+)
+
 type AuthServiceImpl struct {
 	db *gorm.DB
 }
@@ -47,3 +57,63 @@ func (uc *AuthServiceImpl) SignUpUser(user *models.SignUpInput) (*models.User, e
 	}
 	return &newUser, err
 }
+
+// CreateMagicLink creates a login link and returns its token, along with the
+// secret the requesting browser keeps when the link is bound to it. Links sent
+// before stop working.
+func (uc *AuthServiceImpl) CreateMagicLink(userID int, sameDevice bool, expiresIn time.Duration) (string, string, error) {
+	token := randstr.String(32)
+	link := models.MagicLink{
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(expiresIn),
+		UserID:    userID,
+	}
+
+	var deviceSecret string
+	if sameDevice {
+		deviceSecret = randstr.String(32)
+		link.DeviceHash = utils.HashToken(deviceSecret)
+	}
+
+	err := uc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", userID).Delete(&models.MagicLink{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&link).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return token, deviceSecret, nil
+}
+
+// RedeemMagicLink uses up a login link and returns the user it logs in
+func (uc *AuthServiceImpl) RedeemMagicLink(token string, deviceSecret string) (*models.User, error) {
+	var link models.MagicLink
+	err := uc.db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).First(&link).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMagicLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if link.DeviceHash != "" && subtle.ConstantTimeCompare([]byte(utils.HashToken(deviceSecret)), []byte(link.DeviceHash)) != 1 {
+		return nil, ErrMagicLinkOtherDevice
+	}
+
+	// Two clicks racing each other only log in once
+	result := uc.db.Model(&models.MagicLink{}).Where("id = ? AND used_at IS NULL", link.ID).Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrMagicLinkNotFound
+	}
+
+	var user models.User
+	if err := uc.db.First(&user, link.UserID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"time"
+
 	"golang/models"
 
 	"github.com/mashingan/smapping"
@@ -13,6 +15,7 @@ type ColorService interface {
 	Insert(colorInput models.ColorInput) (models.Color, error)
 	Update(id int, colorInput models.ColorInput) (models.Color, error)
 	Delete(color models.Color) error
+	PurgeTrashed(before time.Time) (int64, error)
 }
 
 type colorService struct {
@@ -87,3 +90,33 @@ func (cs *colorService) Delete(color models.Color) error {
 	}
 	return nil
 }
+
+// PurgeTrashed hard-deletes colors trashed before the given time. Todos still
+// pointing at a purged color are detached first so the cascade doesn't take them along,
+// and users stop having it as their default color.
+func (cs *colorService) PurgeTrashed(before time.Time) (int64, error) {
+	var purged int64
+	err := cs.db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.Color{}).Select("id").Where("deleted_at IS NOT NULL AND deleted_at < ?", before)
+
+		err := tx.Unscoped().Model(&models.Todo{}).Where("color_id IN (?)", expired).Update("color_id", nil).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.User{}).Where("pref_default_color_id IN (?)", expired).Update("pref_default_color_id", nil).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&models.Color{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
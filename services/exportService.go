@@ -0,0 +1,249 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang/config"
+	"golang/models"
+	"golang/utils"
+
+	"github.com/thanhpk/randstr"
+	"gorm.io/gorm"
+)
+
+type ExportService interface {
+	Create(userID int, input models.ExportInput) (models.Export, error)
+	FindByID(exportID int, userID int) (models.Export, error)
+	FindByToken(token string) (models.Export, error)
+	RunPending() (int, error)
+	PurgeExpired(now time.Time) (int64, error)
+}
+
+var ErrExportNotReady = errors.New("export is not ready")
+
+// exportStaleAfter is how long an export may run before it's considered
+// abandoned, e.g. by a restart, and built again
+const exportStaleAfter = 30 * time.Minute
+
+type exportService struct {
+	db *gorm.DB
+}
+
+func NewExportService(db *gorm.DB) ExportService {
+	return &exportService{db}
+}
+
+// Create stores an export and builds it in the background
+func (es *exportService) Create(userID int, input models.ExportInput) (models.Export, error) {
+	export := models.Export{
+		Formats:        strings.Join(input.Formats, ","),
+		IncludeDeleted: input.IncludeDeleted,
+		Status:         models.ExportPending,
+		UserID:         userID,
+	}
+	if err := es.db.Create(&export).Error; err != nil {
+		return models.Export{}, err
+	}
+
+	go func() {
+		if err := es.run(export.ID); err != nil {
+			log.Println("export", export.ID, "failed:", err)
+		}
+	}()
+	return export, nil
+}
+
+func (es *exportService) FindByID(exportID int, userID int) (models.Export, error) {
+	var export models.Export
+	err := es.db.Where("user_id = ?", userID).First(&export, exportID).Error
+	if err != nil {
+		return models.Export{}, err
+	}
+	return export, nil
+}
+
+// FindByToken returns the completed export a download link points to
+func (es *exportService) FindByToken(token string) (models.Export, error) {
+	var export models.Export
+	err := es.db.Where("token = ?", utils.HashToken(token)).First(&export).Error
+	if err != nil {
+		return models.Export{}, err
+	}
+	if export.Status != models.ExportCompleted || export.ExpiresAt == nil || export.ExpiresAt.Before(time.Now()) {
+		return models.Export{}, ErrExportNotReady
+	}
+	return export, nil
+}
+
+// RunPending builds the exports that never started or were abandoned mid-way
+func (es *exportService) RunPending() (int, error) {
+	var ids []int
+	err := es.db.Model(&models.Export{}).
+		Where("status = ? OR (status = ? AND started_at < ?)", models.ExportPending, models.ExportRunning, time.Now().Add(-exportStaleAfter)).
+		Where("created_at < ?", time.Now().Add(-time.Minute)).
+		Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := es.run(id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// PurgeExpired removes the archives whose download link expired
+func (es *exportService) PurgeExpired(now time.Time) (int64, error) {
+	var exports []models.Export
+	if err := es.db.Where("expires_at < ?", now).Find(&exports).Error; err != nil {
+		return 0, err
+	}
+
+	for _, export := range exports {
+		if export.Path != "" {
+			if err := os.Remove(export.Path); err != nil && !os.IsNotExist(err) {
+				return 0, err
+			}
+		}
+		if err := es.db.Delete(&export).Error; err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(exports)), nil
+}
+
+// run claims an export, builds its archive and emails the download link. Errors
+// of the export itself are recorded on it, the one returned is the database's.
+func (es *exportService) run(exportID int) error {
+	var export models.Export
+	if err := es.db.Preload("User").First(&export, exportID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claim := es.db.Model(&models.Export{}).
+		Where("id = ? AND status = ? AND (started_at IS NULL OR started_at = ?)", export.ID, export.Status, export.StartedAt).
+		Updates(map[string]interface{}{"status": models.ExportRunning, "started_at": now})
+	if claim.Error != nil {
+		return claim.Error
+	}
+	if claim.RowsAffected == 0 || (export.Status != models.ExportPending && export.Status != models.ExportRunning) {
+		return nil
+	}
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	path, size, err := es.build(export, config.ExportDir, config.Domain)
+	if err != nil {
+		return es.db.Model(&export).Updates(map[string]interface{}{
+			"status": models.ExportFailed, "error": err.Error(), "finished_at": time.Now(),
+		}).Error
+	}
+
+	token := randstr.String(32)
+	finished := time.Now()
+	expires := finished.Add(config.ExportRetention)
+	err = es.db.Model(&export).Updates(map[string]interface{}{
+		"status": models.ExportCompleted, "path": path, "size": size, "token": utils.HashToken(token),
+		"expires_at": expires, "finished_at": finished,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	emailData := utils.EmailData{
+		URL:       config.BaseUrl + "/api/export/download/" + token,
+		FirstName: export.User.Name,
+		Subject:   "Your data export is ready",
+		When:      utils.FormatTime(expires, export.User.Preferences),
+	}
+	// The link only exists in the email, so without it the export is of no use.
+	// The archive goes when it expires.
+	if err := utils.SendEmail(&export.User, &emailData, "exportReady.html"); err != nil {
+		log.Println("export", export.ID, "could not be emailed:", err)
+		return es.db.Model(&export).Updates(map[string]interface{}{
+			"status": models.ExportFailed, "error": "could not email the download link",
+		}).Error
+	}
+	return nil
+}
+
+// build writes the archive of an export into dir
+func (es *exportService) build(export models.Export, dir string, domain string) (string, int64, error) {
+	query := es.db.Preload("Color", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Reminders").Preload("TodoList")
+	if export.IncludeDeleted {
+		query = query.Unscoped()
+	}
+	var todos []*models.Todo
+	if err := query.Where("user_id = ?", export.UserID).Order(positionOrder).Order("id").Find(&todos).Error; err != nil {
+		return "", 0, err
+	}
+
+	colors, tags := exportColorsAndTags(todos)
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("export-%d-%s.zip", export.ID, randstr.Hex(8)))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", 0, err
+	}
+
+	archive := zip.NewWriter(file)
+	err = writeExport(archive, export, todos, colors, tags, domain)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, err
+	}
+	return path, info.Size(), nil
+}
+
+// exportColorsAndTags collects the colors and tags the todos use
+func exportColorsAndTags(todos []*models.Todo) ([]models.Color, []models.ExportTag) {
+	var colors []models.Color
+	seen := map[int]bool{}
+	counts := map[string]int{}
+	for _, todo := range todos {
+		if todo.Color != nil && !seen[todo.Color.ID] {
+			seen[todo.Color.ID] = true
+			colors = append(colors, *todo.Color)
+		}
+		for _, tag := range todo.Tags {
+			counts[tag]++
+		}
+	}
+	sort.Slice(colors, func(i, j int) bool { return colors[i].ID < colors[j].ID })
+
+	tags := make([]models.ExportTag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, models.ExportTag{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return colors, tags
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang/models"
+)
+
+// writeExport writes the files of every requested format into the archive
+func writeExport(archive *zip.Writer, export models.Export, todos []*models.Todo, colors []models.Color, tags []models.ExportTag, domain string) error {
+	profile := models.FilteredResponse(&export.User)
+
+	for _, format := range strings.Split(export.Formats, ",") {
+		var err error
+		switch format {
+		case models.ExportFormatJSON:
+			err = writeExportJSON(archive, profile, todos, colors, tags)
+		case models.ExportFormatCSV:
+			err = writeExportCSV(archive, profile, todos, colors, tags)
+		case models.ExportFormatMarkdown:
+			err = writeExportFile(archive, "markdown/todos.md", func(w io.Writer) error {
+				_, err := io.WriteString(w, exportMarkdown(profile, todos))
+				return err
+			})
+		case models.ExportFormatICS:
+			err = writeExportFile(archive, "ics/todos.ics", func(w io.Writer) error {
+				_, err := io.WriteString(w, RenderCalendar(todos, domain, false))
+				return err
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeExportFile(archive *zip.Writer, name string, write func(w io.Writer) error) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	return write(w)
+}
+
+func writeExportJSON(archive *zip.Writer, profile models.UserResponse, todos []*models.Todo, colors []models.Color, tags []models.ExportTag) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"json/profile.json", profile},
+		{"json/todos.json", todos},
+		{"json/colors.json", colors},
+		{"json/tags.json", tags},
+	}
+	for _, file := range files {
+		err := writeExportFile(archive, file.name, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(file.data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCSVFile(archive *zip.Writer, name string, records [][]string) error {
+	return writeExportFile(archive, name, func(w io.Writer) error {
+		writer := csv.NewWriter(w)
+		if err := writer.WriteAll(records); err != nil {
+			return err
+		}
+		return writer.Error()
+	})
+}
+
+// writeExportCSV writes todos with the headers the CSV import understands, so an
+// export can be imported again
+func writeExportCSV(archive *zip.Writer, profile models.UserResponse, todos []*models.Todo, colors []models.Color, tags []models.ExportTag) error {
+	err := writeCSVFile(archive, "csv/profile.csv", [][]string{
+		{"field", "value"},
+		{"id", strconv.Itoa(profile.ID)},
+		{"email", profile.Email},
+		{"name", profile.Name},
+		{"timezone", profile.Preferences.Timezone},
+		{"locale", profile.Preferences.Locale},
+		{"createdAt", profile.CreatedAt.Format(time.RFC3339)},
+	})
+	if err != nil {
+		return err
+	}
+
+	records := [][]string{{"id", "title", "isi", "completed", "completedAt", "due", "dueTimezone", "reminder", "recurrence", "color", "tags", "list", "createdAt", "deletedAt"}}
+	for _, todo := range todos {
+		color, list := "", ""
+		if todo.Color != nil && todo.Color.ColorCode != nil {
+			color = *todo.Color.ColorCode
+		}
+		if todo.TodoList != nil {
+			list = todo.TodoList.Name
+		}
+		records = append(records, []string{
+			strconv.Itoa(todo.ID), todo.Title, todo.Isi, strconv.FormatBool(todo.Completed), exportTime(todo.CompletedAt),
+			exportDue(*todo), todo.DueTimezone, exportTime(todo.Reminder), todo.Recurrence, color,
+			strings.Join(todo.Tags, ","), list, todo.CreatedAt.Format(time.RFC3339), exportTime(deletedAt(*todo)),
+		})
+	}
+	if err := writeCSVFile(archive, "csv/todos.csv", records); err != nil {
+		return err
+	}
+
+	records = [][]string{{"id", "name", "code"}}
+	for _, color := range colors {
+		name, code := "", ""
+		if color.ColorName != nil {
+			name = *color.ColorName
+		}
+		if color.ColorCode != nil {
+			code = *color.ColorCode
+		}
+		records = append(records, []string{strconv.Itoa(color.ID), name, code})
+	}
+	if err := writeCSVFile(archive, "csv/colors.csv", records); err != nil {
+		return err
+	}
+
+	records = [][]string{{"tag", "count"}}
+	for _, tag := range tags {
+		records = append(records, []string{tag.Name, strconv.Itoa(tag.Count)})
+	}
+	return writeCSVFile(archive, "csv/tags.csv", records)
+}
+
+// exportMarkdown renders the todos as checklists, one section per todo list
+func exportMarkdown(profile models.UserResponse, todos []*models.Todo) string {
+	var b strings.Builder
+	b.WriteString("# Todos of " + profile.Name + "\n")
+
+	var sections []string
+	grouped := map[string][]*models.Todo{}
+	for _, todo := range todos {
+		section := "Inbox"
+		switch {
+		case todo.DeletedAt.Valid:
+			section = "Trash"
+		case todo.TodoList != nil:
+			section = todo.TodoList.Name
+		}
+		if _, ok := grouped[section]; !ok {
+			sections = append(sections, section)
+		}
+		grouped[section] = append(grouped[section], todo)
+	}
+
+	for _, section := range sections {
+		b.WriteString("\n## " + section + "\n\n")
+		for _, todo := range grouped[section] {
+			check := " "
+			if todo.Completed {
+				check = "x"
+			}
+			b.WriteString("- [" + check + "] " + strings.ReplaceAll(todo.Title, "\n", " "))
+			if due := exportDue(*todo); due != "" {
+				b.WriteString(" (due " + due + ")")
+			}
+			for _, tag := range todo.Tags {
+				b.WriteString(" #" + strings.ReplaceAll(tag, " ", "-"))
+			}
+			b.WriteString("\n")
+			if todo.Isi != "" {
+				for _, line := range strings.Split(todo.Isi, "\n") {
+					b.WriteString("  > " + line + "\n")
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+func exportDue(todo models.Todo) string {
+	if todo.DueDate == nil {
+		return ""
+	}
+	if todo.DueAllDay {
+		return todo.DueDate.Format("2006-01-02")
+	}
+	return todo.DueDate.Format(time.RFC3339)
+}
+
+func exportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func deletedAt(todo models.Todo) *time.Time {
+	if !todo.DeletedAt.Valid {
+		return nil
+	}
+	return &todo.DeletedAt.Time
+}
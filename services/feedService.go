@@ -0,0 +1,174 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"golang/config"
+	"golang/models"
+	"golang/utils"
+
+	"github.com/thanhpk/randstr"
+	"gorm.io/gorm"
+)
+
+type FeedService interface {
+	RegenerateToken(userID int) (string, error)
+	Disable(userID int) error
+	FindUserByToken(token string) (*models.User, error)
+	Calendar(userID int, events bool) (string, error)
+}
+
+type feedService struct {
+	db *gorm.DB
+}
+
+func NewFeedService(db *gorm.DB) FeedService {
+	return &feedService{db}
+}
+
+// RegenerateToken issues a new feed token, which revokes every earlier feed URL.
+// Only the hash is stored, so the token can't be shown again later.
+func (fs *feedService) RegenerateToken(userID int) (string, error) {
+	token := randstr.String(32)
+	err := fs.db.Model(&models.User{}).Where("id = ?", userID).Update("feed_token", utils.HashToken(token)).Error
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (fs *feedService) Disable(userID int) error {
+	return fs.db.Model(&models.User{}).Where("id = ?", userID).Update("feed_token", "").Error
+}
+
+func (fs *feedService) FindUserByToken(token string) (*models.User, error) {
+	var user *models.User
+	err := fs.db.Where("feed_token = ?", utils.HashToken(token)).First(&user).Error
+	if err != nil {
+		return &models.User{}, err
+	}
+	return user, nil
+}
+
+// Calendar renders the todos of a user that have a reminder or due date, as VTODO
+// entries or, for calendars that ignore those, as VEVENT entries
+func (fs *feedService) Calendar(userID int, events bool) (string, error) {
+	var todos []*models.Todo
+	err := fs.db.Preload("Reminders").
+		Where("user_id = ? OR todo_list_id IN (?)", userID, sharedTodoListIDs(fs.db, userID)).
+		Where("due_date IS NOT NULL OR reminder IS NOT NULL").
+		Order("id").Find(&todos).Error
+	if err != nil {
+		return "", err
+	}
+
+	config, _ := config.LoadConfig()
+	return RenderCalendar(todos, config.Domain, events), nil
+}
+
+// RenderCalendar writes todos as an iCalendar document
+func RenderCalendar(todos []*models.Todo, domain string, events bool) string {
+	var w utils.ICalWriter
+	w.Line("BEGIN", "VCALENDAR")
+	w.Line("VERSION", "2.0")
+	w.Line("PRODID", "-//Golang Api Todo//EN")
+	w.Line("CALSCALE", "GREGORIAN")
+	w.Text("X-WR-CALNAME", "Todos")
+
+	for _, todo := range todos {
+		writeTodo(&w, *todo, domain, events)
+	}
+
+	w.Line("END", "VCALENDAR")
+	return w.String()
+}
+
+func writeTodo(w *utils.ICalWriter, todo models.Todo, domain string, events bool) {
+	component := "VTODO"
+	if events {
+		component = "VEVENT"
+	}
+
+	// Todos without a due date are placed at their reminder
+	start := dueInstant(todo)
+	if start == nil {
+		start = todo.Reminder
+	}
+	if events && start == nil {
+		return
+	}
+
+	w.Line("BEGIN", component)
+	w.Text("UID", "todo-"+strconv.Itoa(todo.ID)+"@"+domain)
+	stamp := todo.CreatedAt
+	if todo.UpdatedAt != nil {
+		stamp = *todo.UpdatedAt
+	}
+	w.Time("DTSTAMP", stamp)
+	w.Text("SUMMARY", todo.Title)
+	if todo.Isi != "" {
+		w.Text("DESCRIPTION", todo.Isi)
+	}
+	if len(todo.Tags) > 0 {
+		w.TextList("CATEGORIES", todo.Tags)
+	}
+
+	dateProperty := "DUE"
+	if events {
+		dateProperty = "DTSTART"
+	}
+	allDay := todo.DueDate != nil && todo.DueAllDay
+	if start != nil {
+		if allDay {
+			w.Date(dateProperty, *todo.DueDate)
+			if events {
+				w.Date("DTEND", todo.DueDate.AddDate(0, 0, 1))
+			}
+		} else {
+			w.Time(dateProperty, *start)
+			if events {
+				w.Time("DTEND", start.Add(30*time.Minute))
+			}
+		}
+	}
+
+	if todo.Completed {
+		if !events {
+			w.Line("STATUS", "COMPLETED")
+			if todo.CompletedAt != nil {
+				w.Time("COMPLETED", *todo.CompletedAt)
+			}
+		}
+	} else if todo.Recurrence != "" && start != nil {
+		// Only the open occurrence carries the rule, completed ones are history.
+		// DTSTART takes the value type of DUE, a date for all-day todos.
+		if !events && allDay {
+			w.Date("DTSTART", *todo.DueDate)
+		} else if !events {
+			w.Time("DTSTART", *start)
+		}
+		w.Line("RRULE", todo.Recurrence)
+	}
+
+	// Only the reminders that are sent become alarms, the legacy reminder is
+	// one of them when it is set
+	for _, reminder := range todo.Reminders {
+		switch {
+		case reminder.At != nil:
+			writeAlarm(w, todo.Title, "TRIGGER;VALUE=DATE-TIME", utils.ICalTime(*reminder.At))
+		case reminder.OffsetMinutes != nil && start != nil:
+			writeAlarm(w, todo.Title, "TRIGGER", utils.ICalDuration(time.Duration(*reminder.OffsetMinutes)*time.Minute))
+		}
+	}
+
+	w.Line("END", component)
+}
+
+func writeAlarm(w *utils.ICalWriter, title string, trigger string, value string) {
+	w.Line("BEGIN", "VALARM")
+	w.Line("ACTION", "DISPLAY")
+	w.Text("DESCRIPTION", title)
+	w.Line(trigger, value)
+	w.Line("END", "VALARM")
+}
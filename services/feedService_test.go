@@ -0,0 +1,41 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang/models"
+)
+
+func TestRenderCalendarRecurrence(t *testing.T) {
+	due := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	at := time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		todo  models.Todo
+		lines []string
+	}{
+		{
+			name:  "all day",
+			todo:  models.Todo{ID: 1, Title: "Water plants", DueDate: &due, DueAllDay: true, DueTimezone: "UTC", Recurrence: "FREQ=WEEKLY"},
+			lines: []string{"DUE;VALUE=DATE:20240304", "DTSTART;VALUE=DATE:20240304", "RRULE:FREQ=WEEKLY"},
+		},
+		{
+			name:  "at a time",
+			todo:  models.Todo{ID: 2, Title: "Stand-up", DueDate: &at, Recurrence: "FREQ=DAILY"},
+			lines: []string{"DUE:20240304T093000Z", "DTSTART:20240304T093000Z", "RRULE:FREQ=DAILY"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calendar := RenderCalendar([]*models.Todo{&test.todo}, "example.com", false)
+			for _, line := range test.lines {
+				if !strings.Contains(calendar, "\r\n"+line+"\r\n") {
+					t.Errorf("missing %q in\n%s", line, calendar)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"golang/config"
+	"golang/models"
+	"golang/utils"
+
+	"github.com/thanhpk/randstr"
+	"gorm.io/gorm"
+)
+
+type IdentityService interface {
+	Providers() []string
+	StartLogin(provider string, userID *int) (string, string, error)
+	FinishLogin(provider string, state string, code string) (*models.User, error)
+	All(userID int) ([]*models.UserIdentity, error)
+	Unlink(userID int, provider string) error
+}
+
+var (
+	ErrUnknownProvider   = errors.New("unknown login provider")
+	ErrOIDCLoginNotFound = errors.New("login not found or expired")
+	ErrIdentityTaken     = errors.New("this account is linked to another user")
+	ErrProviderLinked    = errors.New("another account of this provider is already linked")
+	ErrEmailNotVerified  = errors.New("the provider did not confirm the email of the account")
+	ErrIdentityNotFound  = errors.New("identity not found")
+	ErrLastLoginMethod   = errors.New("set a password before unlinking the last login provider")
+)
+
+// oidcLoginExpiry is how long the user has to log in with the provider
+const oidcLoginExpiry = 10 * time.Minute
+
+// identityAction is what a finished login does with the identity it found
+type identityAction int
+
+const (
+	// identityLogin logs in the user the identity is linked to
+	identityLogin identityAction = iota
+	// identityLink links the identity to the user who started the login
+	identityLink
+	// identityByEmail links the identity to the user with its verified email,
+	// or to a new user
+	identityByEmail
+)
+
+type identityService struct {
+	db *gorm.DB
+}
+
+func NewIdentityService(db *gorm.DB) IdentityService {
+	return &identityService{db}
+}
+
+func (is *identityService) Providers() []string {
+	config, _ := config.LoadConfig()
+	names := make([]string, 0, len(config.OIDCProviders))
+	for _, provider := range config.OIDCProviders {
+		names = append(names, provider.Name)
+	}
+	return names
+}
+
+// StartLogin records a login with a provider and returns the authorization URL
+// to send the user to, along with the state the callback will carry. Logged in
+// users pass their id to link the provider to their account.
+func (is *identityService) StartLogin(name string, userID *int) (string, string, error) {
+	provider, redirectURI, err := findProvider(name)
+	if err != nil {
+		return "", "", err
+	}
+	discovery, err := utils.DiscoverOIDC(provider.Issuer)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	if err := is.db.Where("expires_at < ?", now).Delete(&models.OIDCLogin{}).Error; err != nil {
+		return "", "", err
+	}
+
+	state, nonce, verifier := randstr.String(32), randstr.String(32), randstr.String(64)
+	err = is.db.Create(&models.OIDCLogin{
+		State:        utils.HashToken(state),
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userID,
+		ExpiresAt:    now.Add(oidcLoginExpiry),
+	}).Error
+	if err != nil {
+		return "", "", err
+	}
+
+	return discovery.AuthCodeURL(provider.ClientID, redirectURI, provider.Scopes, state, nonce, verifier), state, nil
+}
+
+// FinishLogin redeems the code the provider sent back and returns the user it
+// identifies. Unknown identities are linked to the user with the same verified
+// email, or to a new user when there is none.
+func (is *identityService) FinishLogin(name string, state string, code string) (*models.User, error) {
+	provider, redirectURI, err := findProvider(name)
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	var login models.OIDCLogin
+	err = is.db.Where("state = ? AND provider = ? AND expires_at > ?", utils.HashToken(state), provider.Name, time.Now()).First(&login).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.User{}, ErrOIDCLoginNotFound
+	}
+	if err != nil {
+		return &models.User{}, err
+	}
+	// A state is good for one callback only
+	deleted := is.db.Delete(&login)
+	if deleted.Error != nil {
+		return &models.User{}, deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return &models.User{}, ErrOIDCLoginNotFound
+	}
+
+	discovery, err := utils.DiscoverOIDC(provider.Issuer)
+	if err != nil {
+		return &models.User{}, err
+	}
+	idToken, err := discovery.Exchange(provider.ClientID, provider.ClientSecret, redirectURI, code, login.CodeVerifier)
+	if err != nil {
+		return &models.User{}, err
+	}
+	claims, err := discovery.VerifyIDToken(idToken, provider.ClientID, login.Nonce)
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	var user models.User
+	err = is.db.Transaction(func(tx *gorm.DB) error {
+		var identity models.UserIdentity
+		err := tx.Where("provider = ? AND subject = ?", provider.Name, claims.Subject).Limit(1).Find(&identity).Error
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		action, err := resolveIdentity(login, identity, claims)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case identityLink:
+			return is.link(tx, *login.UserID, provider.Name, claims, &user)
+		case identityLogin:
+			if err := tx.Model(&identity).Updates(map[string]interface{}{"email": claims.Email, "last_login_at": now}).Error; err != nil {
+				return err
+			}
+			return tx.First(&user, identity.UserID).Error
+		}
+
+		err = tx.Where("email = ?", strings.ToLower(claims.Email)).Limit(1).Find(&user).Error
+		if err != nil {
+			return err
+		}
+		if user.ID == 0 {
+			user = models.User{
+				Name:      claims.Name,
+				Email:     strings.ToLower(claims.Email),
+				Verified:  true,
+				Role:      "user",
+				Avatar:    claims.Picture,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			if user.Name == "" {
+				user.Name, _, _ = strings.Cut(user.Email, "@")
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		} else if !user.Verified {
+			// Anyone could have registered the address without owning it, the
+			// password they chose must not open the account anymore
+			err := tx.Model(&user).Updates(map[string]interface{}{"verified": true, "verification_code": "", "password": ""}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return is.link(tx, user.ID, provider.Name, claims, &user)
+	})
+	if err != nil {
+		return &models.User{}, err
+	}
+	return &user, nil
+}
+
+// link adds an identity to a user and loads the user
+func (is *identityService) link(tx *gorm.DB, userID int, provider string, claims *utils.OIDCClaims, user *models.User) error {
+	var linked int64
+	if err := tx.Model(&models.UserIdentity{}).Where("user_id = ? AND provider = ?", userID, provider).Count(&linked).Error; err != nil {
+		return err
+	}
+	if err := checkLink(linked); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err := tx.Create(&models.UserIdentity{
+		Provider:    provider,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+		UserID:      userID,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.First(user, userID).Error
+}
+
+func (is *identityService) All(userID int) ([]*models.UserIdentity, error) {
+	var identities []*models.UserIdentity
+	err := is.db.Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Unlink removes a provider from a user, keeping at least one way to log in
+func (is *identityService) Unlink(userID int, provider string) error {
+	return is.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return err
+		}
+
+		var identities int64
+		if err := tx.Model(&models.UserIdentity{}).Where("user_id = ?", userID).Count(&identities).Error; err != nil {
+			return err
+		}
+		if err := checkUnlink(user, identities); err != nil {
+			return err
+		}
+
+		result := tx.Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.UserIdentity{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrIdentityNotFound
+		}
+		return nil
+	})
+}
+
+// resolveIdentity decides what a login does with the identity of the provider
+// account, which has no ID when the account isn't linked yet. Logins started by
+// a logged in user link to them, others log in the linked user or fall back to
+// a verified email.
+func resolveIdentity(login models.OIDCLogin, identity models.UserIdentity, claims *utils.OIDCClaims) (identityAction, error) {
+	switch {
+	case login.UserID != nil && identity.ID != 0 && identity.UserID != *login.UserID:
+		return 0, ErrIdentityTaken
+	case login.UserID != nil && identity.ID == 0:
+		return identityLink, nil
+	case identity.ID != 0:
+		return identityLogin, nil
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return 0, ErrEmailNotVerified
+	}
+	return identityByEmail, nil
+}
+
+// checkLink allows one account per provider and user, given how many the user
+// has linked already
+func checkLink(linked int64) error {
+	if linked > 0 {
+		return ErrProviderLinked
+	}
+	return nil
+}
+
+// checkUnlink keeps at least one way to log in: a password or another provider
+func checkUnlink(user models.User, identities int64) error {
+	if user.Password == "" && identities <= 1 {
+		return ErrLastLoginMethod
+	}
+	return nil
+}
+
+// findProvider returns the configured provider with the given name and the URI
+// it redirects back to
+func findProvider(name string) (provider config.OIDCProvider, redirectURI string, err error) {
+	config, _ := config.LoadConfig()
+	for _, configured := range config.OIDCProviders {
+		if configured.Name == name {
+			return configured, config.BaseUrl + "/api/auth/oidc/" + configured.Name + "/callback", nil
+		}
+	}
+	err = ErrUnknownProvider
+	return
+}
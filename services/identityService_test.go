@@ -0,0 +1,73 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"golang/models"
+	"golang/utils"
+)
+
+func TestResolveIdentity(t *testing.T) {
+	loggedIn := 1
+	verified := &utils.OIDCClaims{Subject: "subject-1", Email: "alice@example.com", EmailVerified: true}
+	unverified := &utils.OIDCClaims{Subject: "subject-1", Email: "alice@example.com"}
+
+	tests := []struct {
+		name     string
+		login    models.OIDCLogin
+		identity models.UserIdentity
+		claims   *utils.OIDCClaims
+		action   identityAction
+		err      error
+	}{
+		{name: "link to the logged in user", login: models.OIDCLogin{UserID: &loggedIn}, claims: unverified, action: identityLink},
+		{name: "linked to the logged in user already", login: models.OIDCLogin{UserID: &loggedIn}, identity: models.UserIdentity{ID: 5, UserID: 1}, claims: verified, action: identityLogin},
+		{name: "linked to another user", login: models.OIDCLogin{UserID: &loggedIn}, identity: models.UserIdentity{ID: 5, UserID: 2}, claims: verified, err: ErrIdentityTaken},
+		{name: "log in a linked user", identity: models.UserIdentity{ID: 5, UserID: 2}, claims: unverified, action: identityLogin},
+		{name: "verified email", claims: verified, action: identityByEmail},
+		{name: "unverified email", claims: unverified, err: ErrEmailNotVerified},
+		{name: "no email", claims: &utils.OIDCClaims{Subject: "subject-1", EmailVerified: true}, err: ErrEmailNotVerified},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action, err := resolveIdentity(test.login, test.identity, test.claims)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got error %v, want %v", err, test.err)
+			}
+			if err == nil && action != test.action {
+				t.Errorf("got action %d, want %d", action, test.action)
+			}
+		})
+	}
+}
+
+func TestCheckLink(t *testing.T) {
+	if err := checkLink(0); err != nil {
+		t.Errorf("first account of the provider: %v", err)
+	}
+	if err := checkLink(1); !errors.Is(err, ErrProviderLinked) {
+		t.Errorf("second account of the provider: %v", err)
+	}
+}
+
+func TestCheckUnlink(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		identities int64
+		err        error
+	}{
+		{name: "password and one provider", password: "hash", identities: 1},
+		{name: "two providers", identities: 2},
+		{name: "last provider without password", identities: 1, err: ErrLastLoginMethod},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkUnlink(models.User{Password: test.password}, test.identities)
+			if !errors.Is(err, test.err) {
+				t.Errorf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang/config"
+	"golang/models"
+	"golang/utils"
+
+	"github.com/thanhpk/randstr"
+	"gorm.io/gorm"
+)
+
+type OAuthService interface {
+	CreateClient(userID int, input models.OAuthClientInput) (models.OAuthClientCreated, error)
+	Clients(userID int) ([]*models.OAuthClient, error)
+	DeleteClient(id int, userID int) error
+	FindClient(clientID string) (*models.OAuthClient, error)
+	Authenticate(clientID string, secret string) (*models.OAuthClient, error)
+	Authorize(client *models.OAuthClient, userID int, redirectURI string, scopes models.Scopes, codeChallenge string) (string, error)
+	ExchangeCode(client *models.OAuthClient, code string, redirectURI string, verifier string) (models.OAuthTokenResponse, error)
+	Refresh(client *models.OAuthClient, refreshToken string, scope string) (models.OAuthTokenResponse, error)
+	Introspect(client *models.OAuthClient, token string) (models.OAuthIntrospection, error)
+	Revoke(client *models.OAuthClient, token string) error
+	Grants(userID int) ([]*models.OAuthGrant, error)
+	RevokeGrant(id int, userID int) error
+}
+
+// OAuthError is an error code of RFC 6749, sent back to clients as is
+type OAuthError struct {
+	Code string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code
+}
+
+var (
+	ErrInvalidRequest = &OAuthError{"invalid_request"}
+	ErrInvalidClient  = &OAuthError{"invalid_client"}
+	ErrInvalidGrant   = &OAuthError{"invalid_grant"}
+	ErrInvalidScope   = &OAuthError{"invalid_scope"}
+
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrOAuthGrantNotFound  = errors.New("oauth grant not found")
+)
+
+const (
+	// oauthCodeExpiry is how long a client has to exchange an authorization code
+	oauthCodeExpiry = 5 * time.Minute
+	// oauthRefreshTokenPrefix tells refresh tokens apart from access tokens
+	oauthRefreshTokenPrefix = "ort_"
+)
+
+type oauthService struct {
+	db *gorm.DB
+}
+
+func NewOAuthService(db *gorm.DB) OAuthService {
+	return &oauthService{db}
+}
+
+// CreateClient registers an app. Confidential clients get a secret, returned
+// only this once.
+func (oas *oauthService) CreateClient(userID int, input models.OAuthClientInput) (models.OAuthClientCreated, error) {
+	client := models.OAuthClient{
+		ClientID:     randstr.Hex(16),
+		Name:         input.Name,
+		RedirectURIs: input.RedirectURIs,
+		Scopes:       input.Scopes,
+		Confidential: input.Confidential,
+		UserID:       userID,
+	}
+
+	var secret string
+	if input.Confidential {
+		secret = "ocs_" + randstr.String(40)
+		client.SecretHash = utils.HashToken(secret)
+	}
+
+	if err := oas.db.Create(&client).Error; err != nil {
+		return models.OAuthClientCreated{}, err
+	}
+	return models.OAuthClientCreated{ClientSecret: secret, Client: client}, nil
+}
+
+func (oas *oauthService) Clients(userID int) ([]*models.OAuthClient, error) {
+	var clients []*models.OAuthClient
+	err := oas.db.Where("user_id = ?", userID).Order("id").Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient removes an app along with the access users gave it
+func (oas *oauthService) DeleteClient(id int, userID int) error {
+	return oas.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.OAuthClient{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOAuthClientNotFound
+		}
+
+		if err := tx.Where("client_id = ?", id).Delete(&models.OAuthCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("client_id = ?", id).Delete(&models.OAuthGrant{}).Error
+	})
+}
+
+func (oas *oauthService) FindClient(clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := oas.db.Where("client_id = ?", clientID).First(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// Authenticate checks the credentials a client sent to the token endpoint.
+// Public clients only send their id.
+func (oas *oauthService) Authenticate(clientID string, secret string) (*models.OAuthClient, error) {
+	client, err := oas.FindClient(clientID)
+	if errors.Is(err, ErrOAuthClientNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.Confidential {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(client.SecretHash)) != 1 {
+			return nil, ErrInvalidClient
+		}
+	} else if secret != "" {
+		return nil, ErrInvalidClient
+	}
+	return client, nil
+}
+
+// Authorize issues an authorization code once the user consented
+func (oas *oauthService) Authorize(client *models.OAuthClient, userID int, redirectURI string, scopes models.Scopes, codeChallenge string) (string, error) {
+	now := time.Now()
+	if err := oas.db.Where("expires_at < ?", now).Delete(&models.OAuthCode{}).Error; err != nil {
+		return "", err
+	}
+
+	code := randstr.String(32)
+	err := oas.db.Create(&models.OAuthCode{
+		CodeHash:      utils.HashToken(code),
+		RedirectURI:   redirectURI,
+		Scopes:        scopes,
+		CodeChallenge: codeChallenge,
+		ExpiresAt:     now.Add(oauthCodeExpiry),
+		ClientID:      client.ID,
+		UserID:        userID,
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code for a new grant
+func (oas *oauthService) ExchangeCode(client *models.OAuthClient, code string, redirectURI string, verifier string) (models.OAuthTokenResponse, error) {
+	var authorization models.OAuthCode
+	err := oas.db.Where("code_hash = ? AND client_id = ? AND expires_at > ?", utils.HashToken(code), client.ID, time.Now()).First(&authorization).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.OAuthTokenResponse{}, fmt.Errorf("%w: the code is invalid or expired", ErrInvalidGrant)
+	}
+	if err != nil {
+		return models.OAuthTokenResponse{}, err
+	}
+	// A code is good for one exchange only
+	deleted := oas.db.Delete(&authorization)
+	if deleted.Error != nil {
+		return models.OAuthTokenResponse{}, deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return models.OAuthTokenResponse{}, fmt.Errorf("%w: the code was already used", ErrInvalidGrant)
+	}
+
+	if authorization.RedirectURI != redirectURI {
+		return models.OAuthTokenResponse{}, fmt.Errorf("%w: redirect_uri does not match", ErrInvalidGrant)
+	}
+	if verifier == "" || subtle.ConstantTimeCompare([]byte(utils.PKCEChallenge(verifier)), []byte(authorization.CodeChallenge)) != 1 {
+		return models.OAuthTokenResponse{}, fmt.Errorf("%w: code_verifier does not match", ErrInvalidGrant)
+	}
+
+	config, _ := config.LoadConfig()
+	refreshToken := oauthRefreshTokenPrefix + randstr.String(40)
+	grant := models.OAuthGrant{
+		Scopes:           authorization.Scopes,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		RefreshExpiresAt: time.Now().Add(config.OAuthRefreshTokenExpiresIn),
+		ClientID:         client.ID,
+		UserID:           authorization.UserID,
+	}
+	if err := oas.db.Create(&grant).Error; err != nil {
+		return models.OAuthTokenResponse{}, err
+	}
+
+	return oas.issue(client, grant, grant.Scopes, refreshToken)
+}
+
+// Refresh replaces a refresh token with a new one and a new access token,
+// optionally narrowed to fewer scopes
+func (oas *oauthService) Refresh(client *models.OAuthClient, refreshToken string, scope string) (models.OAuthTokenResponse, error) {
+	grant, err := oas.findGrantByRefreshToken(refreshToken)
+	if err != nil {
+		return models.OAuthTokenResponse{}, err
+	}
+	if grant.ClientID != client.ID {
+		return models.OAuthTokenResponse{}, fmt.Errorf("%w: the refresh token is invalid or expired", ErrInvalidGrant)
+	}
+
+	scopes := grant.Scopes
+	if scope != "" {
+		if scopes, err = ParseOAuthScopes(scope, grant.Scopes); err != nil {
+			return models.OAuthTokenResponse{}, err
+		}
+	}
+
+	config, _ := config.LoadConfig()
+	newRefreshToken := oauthRefreshTokenPrefix + randstr.String(40)
+	now := time.Now()
+	result := oas.db.Model(&models.OAuthGrant{}).Where("id = ? AND refresh_token_hash = ?", grant.ID, grant.RefreshTokenHash).Updates(map[string]interface{}{
+		"refresh_token_hash": utils.HashToken(newRefreshToken),
+		"refresh_expires_at": now.Add(config.OAuthRefreshTokenExpiresIn),
+		"last_used_at":       now,
+	})
+	if result.Error != nil {
+		return models.OAuthTokenResponse{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.OAuthTokenResponse{}, fmt.Errorf("%w: the refresh token was already used", ErrInvalidGrant)
+	}
+
+	return oas.issue(client, *grant, scopes, newRefreshToken)
+}
+
+// issue signs an access token for a grant
+func (oas *oauthService) issue(client *models.OAuthClient, grant models.OAuthGrant, scopes models.Scopes, refreshToken string) (models.OAuthTokenResponse, error) {
+	config, _ := config.LoadConfig()
+	scope := strings.Join(scopes, " ")
+	accessToken, err := utils.CreateTokenWithClaims(config.AccessTokenExpiresIn, map[string]interface{}{
+		"sub":       grant.UserID,
+		"grant":     grant.ID,
+		"client_id": client.ClientID,
+		"scope":     scope,
+	}, utils.AccessTokenKeys)
+	if err != nil {
+		return models.OAuthTokenResponse{}, err
+	}
+
+	return models.OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(config.AccessTokenExpiresIn.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+	}, nil
+}
+
+// Introspect describes a token issued to the client. Tokens of other clients
+// are reported as inactive.
+func (oas *oauthService) Introspect(client *models.OAuthClient, token string) (models.OAuthIntrospection, error) {
+	if strings.HasPrefix(token, oauthRefreshTokenPrefix) {
+		grant, err := oas.findGrantByRefreshToken(token)
+		if errors.Is(err, ErrInvalidGrant) || (err == nil && grant.ClientID != client.ID) {
+			return models.OAuthIntrospection{}, nil
+		}
+		if err != nil {
+			return models.OAuthIntrospection{}, err
+		}
+		return models.OAuthIntrospection{
+			Active:    true,
+			Scope:     strings.Join(grant.Scopes, " "),
+			ClientID:  client.ClientID,
+			Subject:   strconv.Itoa(grant.UserID),
+			TokenType: "refresh_token",
+			ExpiresAt: grant.RefreshExpiresAt.Unix(),
+		}, nil
+	}
+
+	claims, err := utils.ParseToken(token, utils.AccessTokenKeys)
+	if err != nil {
+		return models.OAuthIntrospection{}, nil
+	}
+	grantID, ok := claims["grant"].(float64)
+	if !ok {
+		return models.OAuthIntrospection{}, nil
+	}
+	grant, err := findOAuthGrant(oas.db, int(grantID))
+	if errors.Is(err, ErrOAuthGrantNotFound) || (err == nil && grant.ClientID != client.ID) {
+		return models.OAuthIntrospection{}, nil
+	}
+	if err != nil {
+		return models.OAuthIntrospection{}, err
+	}
+
+	scope, _ := claims["scope"].(string)
+	exp, _ := claims["exp"].(float64)
+	iat, _ := claims["iat"].(float64)
+	return models.OAuthIntrospection{
+		Active:    true,
+		Scope:     scope,
+		ClientID:  client.ClientID,
+		Subject:   strconv.Itoa(grant.UserID),
+		TokenType: "access_token",
+		ExpiresAt: int64(exp),
+		IssuedAt:  int64(iat),
+	}, nil
+}
+
+// Revoke ends the grant of an access or refresh token. Unknown tokens and
+// tokens of other clients are ignored, as RFC 7009 asks.
+func (oas *oauthService) Revoke(client *models.OAuthClient, token string) error {
+	introspection, err := oas.Introspect(client, token)
+	if err != nil || !introspection.Active {
+		return err
+	}
+
+	var grant *models.OAuthGrant
+	if strings.HasPrefix(token, oauthRefreshTokenPrefix) {
+		grant, err = oas.findGrantByRefreshToken(token)
+	} else {
+		claims, _ := utils.ParseToken(token, utils.AccessTokenKeys)
+		grant, err = findOAuthGrant(oas.db, int(claims["grant"].(float64)))
+	}
+	if err != nil {
+		return err
+	}
+	return oas.db.Model(grant).Update("revoked_at", time.Now()).Error
+}
+
+// Grants lists the apps a user gave access to
+func (oas *oauthService) Grants(userID int) ([]*models.OAuthGrant, error) {
+	var grants []*models.OAuthGrant
+	err := oas.db.Preload("Client").Where("user_id = ? AND revoked_at IS NULL", userID).Order("id").Find(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+func (oas *oauthService) RevokeGrant(id int, userID int) error {
+	result := oas.db.Model(&models.OAuthGrant{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOAuthGrantNotFound
+	}
+	return nil
+}
+
+func (oas *oauthService) findGrantByRefreshToken(token string) (*models.OAuthGrant, error) {
+	var grant models.OAuthGrant
+	err := oas.db.Where("refresh_token_hash = ? AND revoked_at IS NULL AND refresh_expires_at > ?", utils.HashToken(token), time.Now()).First(&grant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: the refresh token is invalid or expired", ErrInvalidGrant)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// findOAuthGrant returns the grant an access token was issued for, unless it
+// was revoked
+func findOAuthGrant(db *gorm.DB, id int) (*models.OAuthGrant, error) {
+	var grant models.OAuthGrant
+	err := db.Where("id = ? AND revoked_at IS NULL", id).First(&grant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOAuthGrantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// ParseOAuthScopes reads the space separated scopes a client asked for, all of
+// them when it asked for none
+func ParseOAuthScopes(scope string, allowed models.Scopes) (models.Scopes, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+
+	scopes := models.Scopes{}
+	for _, name := range requested {
+		found := false
+		for _, candidate := range allowed {
+			found = found || candidate == name
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s is not allowed", ErrInvalidScope, name)
+		}
+		scopes = append(scopes, name)
+	}
+	return scopes, nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"golang/models"
+
+	"gorm.io/gorm"
+)
+
+// PermissionService resolves the role a user holds on a todo or todo list, taking
+// ownership and accepted list shares into account
+type PermissionService interface {
+	TodoRole(userID int, todoID int) (string, error)
+	TodoListRole(userID int, todoListID int) (string, error)
+	CanTodo(userID int, todoID int, required string) bool
+	CanTodoList(userID int, todoListID int, required string) bool
+}
+
+type permissionService struct {
+	db *gorm.DB
+}
+
+func NewPermissionService(db *gorm.DB) PermissionService {
+	return &permissionService{db}
+}
+
+func (ps *permissionService) TodoRole(userID int, todoID int) (string, error) {
+	var todo models.Todo
+	// Trashed todos are resolved too so they can be restored by whoever may edit them
+	err := ps.db.Unscoped().Find(&todo, todoID).Error
+	if err != nil || todo.ID != todoID {
+		return "", err
+	}
+	return todoRole(ps.db, userID, todo)
+}
+
+func (ps *permissionService) TodoListRole(userID int, todoListID int) (string, error) {
+	return todoListRole(ps.db, userID, todoListID)
+}
+
+func (ps *permissionService) CanTodo(userID int, todoID int, required string) bool {
+	role, err := ps.TodoRole(userID, todoID)
+	return err == nil && models.RoleAtLeast(role, required)
+}
+
+func (ps *permissionService) CanTodoList(userID int, todoListID int, required string) bool {
+	role, err := ps.TodoListRole(userID, todoListID)
+	return err == nil && models.RoleAtLeast(role, required)
+}
+
+// todoRole gives the creator of a todo full control, everyone else inherits their
+// role on the list the todo lives in
+func todoRole(tx *gorm.DB, userID int, todo models.Todo) (string, error) {
+	if todo.UserID == userID {
+		return models.RoleOwner, nil
+	}
+	if todo.TodoListID == nil {
+		return "", nil
+	}
+	return todoListRole(tx, userID, *todo.TodoListID)
+}
+
+func todoListRole(tx *gorm.DB, userID int, todoListID int) (string, error) {
+	var todoList models.TodoList
+	err := tx.Find(&todoList, todoListID).Error
+	if err != nil || todoList.ID != todoListID {
+		return "", err
+	}
+	if todoList.UserID == userID {
+		return models.RoleOwner, nil
+	}
+
+	var roles []string
+	err = tx.Model(&models.TodoListShare{}).Where("todo_list_id = ? AND user_id = ? AND status = ?", todoListID, userID, models.ShareAccepted).Pluck("role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+// sharedTodoListIDs selects the lists other users shared with the user
+func sharedTodoListIDs(tx *gorm.DB, userID int) *gorm.DB {
+	return tx.Model(&models.TodoListShare{}).Select("todo_list_id").Where("user_id = ? AND status = ?", userID, models.ShareAccepted)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"errors"
+
+	"golang/models"
+	"golang/utils"
+
+	"gorm.io/gorm"
+)
+
+var ErrAnchorNotFound = errors.New("item to move next to was not found")
+
+// positionOrder sorts by rank bytewise, independent of the database collation
+const positionOrder = `position COLLATE "C"`
+
+// movePosition places the row with the given id directly before or after another
+// row of the same user. Only the moved row is written unless the user's ranks
+// have to be rebalanced first.
+func movePosition(db *gorm.DB, model interface{}, id int, userID int, input models.MoveInput) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Legacy rows without a rank or colliding ranks leave no gap to move into
+		var stats struct {
+			Total  int64
+			Ranked int64
+		}
+		err := tx.Model(model).Select(`count(*) AS total, count(DISTINCT NULLIF(position, '')) AS ranked`).Where("user_id = ? AND id <> ?", userID, id).Scan(&stats).Error
+		if err != nil {
+			return err
+		}
+		if stats.Total != stats.Ranked {
+			if err := rebalancePositions(tx, model, userID); err != nil {
+				return err
+			}
+		}
+
+		prev, next, err := moveNeighbours(tx, model, id, userID, input)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(model).Where("id = ?", id).Update("position", utils.RankBetween(prev, next)).Error
+	})
+}
+
+// moveNeighbours returns the ranks the moved row has to fit between
+func moveNeighbours(tx *gorm.DB, model interface{}, id int, userID int, input models.MoveInput) (string, string, error) {
+	anchorID := input.AfterID
+	if input.BeforeID != nil {
+		anchorID = input.BeforeID
+	}
+
+	var anchors []string
+	err := tx.Model(model).Where("user_id = ? AND id = ? AND id <> ?", userID, *anchorID, id).Pluck("position", &anchors).Error
+	if err != nil {
+		return "", "", err
+	}
+	if len(anchors) == 0 {
+		return "", "", ErrAnchorNotFound
+	}
+	anchor := anchors[0]
+
+	var neighbours []string
+	query := tx.Model(model).Where("user_id = ? AND id NOT IN ?", userID, []int{id, *anchorID}).Limit(1)
+	if input.BeforeID != nil {
+		err = query.Where(positionOrder+" < ?", anchor).Order(positionOrder+" desc").Pluck("position", &neighbours).Error
+		if err != nil || len(neighbours) == 0 {
+			return "", anchor, err
+		}
+		return neighbours[0], anchor, nil
+	}
+
+	err = query.Where(positionOrder+" > ?", anchor).Order(positionOrder).Pluck("position", &neighbours).Error
+	if err != nil || len(neighbours) == 0 {
+		return anchor, "", err
+	}
+	return anchor, neighbours[0], nil
+}
+
+// lastPosition returns the highest rank of a user, or "" when there is none yet
+func lastPosition(tx *gorm.DB, model interface{}, userID int) (string, error) {
+	var positions []string
+	err := tx.Model(model).Where("user_id = ?", userID).Order(positionOrder+" desc").Limit(1).Pluck("position", &positions).Error
+	if err != nil || len(positions) == 0 {
+		return "", err
+	}
+	return positions[0], nil
+}
+
+// rebalancePositions rewrites the ranks of all rows of a user, keeping their order
+func rebalancePositions(tx *gorm.DB, model interface{}, userID int) error {
+	var ids []int
+	err := tx.Unscoped().Model(model).Where("user_id = ?", userID).Order(positionOrder).Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	for i, position := range utils.RankSequence(len(ids)) {
+		err := tx.Unscoped().Model(model).Where("id = ?", ids[i]).Update("position", position).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
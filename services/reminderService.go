@@ -0,0 +1,84 @@
+package services
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"golang/config"
+	"golang/models"
+	"golang/utils"
+
+	"gorm.io/gorm"
+)
+
+type ReminderService interface {
+	SendDue(now time.Time) (int, error)
+}
+
+// maxReminderAttempts is how many times sending a reminder is tried before it
+// is given up on
+const maxReminderAttempts = 3
+
+type reminderService struct {
+	db *gorm.DB
+}
+
+func NewReminderService(db *gorm.DB) ReminderService {
+	return &reminderService{db}
+}
+
+// SendDue emails every reminder that came due for an open todo. Reminders of users
+// who turned reminder emails off are marked as sent without an email. A failed
+// email is recorded on its reminder and tried again on the next run, without
+// holding back the others.
+func (rs *reminderService) SendDue(now time.Time) (int, error) {
+	var reminders []models.TodoReminder
+	err := rs.db.Joins("JOIN todo ON todo.id = todo_reminder.todo_id AND todo.deleted_at IS NULL AND NOT todo.completed").
+		Where("todo_reminder.remind_at <= ? AND todo_reminder.sent_at IS NULL AND todo_reminder.attempts < ?", now, maxReminderAttempts).
+		Order("todo_reminder.remind_at").Limit(100).Find(&reminders).Error
+	if err != nil {
+		return 0, err
+	}
+
+	config, err := config.LoadConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, reminder := range reminders {
+		var todo models.Todo
+		if err := rs.db.Preload("User").Find(&todo, reminder.TodoID).Error; err != nil {
+			return sent, err
+		}
+
+		if todo.User.Preferences.EmailReminders {
+			emailData := utils.EmailData{
+				URL:       config.BaseUrl + "/api/todo/detail/" + strconv.Itoa(todo.ID),
+				FirstName: todo.User.Name,
+				Subject:   "Reminder: " + todo.Title,
+				TodoTitle: todo.Title,
+			}
+			if due := dueInstant(todo); due != nil {
+				emailData.When = utils.FormatTime(*due, todo.User.Preferences)
+			}
+			if err := utils.SendEmail(&todo.User, &emailData, "todoReminder.html"); err != nil {
+				log.Println("Could not send reminder", reminder.ID, err)
+				err = rs.db.Model(&reminder).Updates(map[string]interface{}{
+					"attempts": gorm.Expr("attempts + 1"), "error": err.Error(),
+				}).Error
+				if err != nil {
+					return sent, err
+				}
+				continue
+			}
+			sent++
+		}
+
+		if err := rs.db.Model(&reminder).Update("sent_at", now).Error; err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang/config"
+	"golang/models"
+	"golang/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SigningKeyService interface {
+	Load() error
+	Rotate(purpose string) (*models.SigningKey, error)
+}
+
+var ErrUnknownKeyPurpose = errors.New("unknown key purpose")
+
+// keyActivationDelay gives every instance time to load a new key before tokens
+// signed with it reach them
+const keyActivationDelay = 2 * time.Minute
+
+type signingKeyService struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyService(db *gorm.DB) SigningKeyService {
+	return &signingKeyService{db}
+}
+
+// Load reads the keys into the key sets tokens are signed and verified with,
+// retiring the keys whose tokens have all expired. It runs at startup and
+// regularly after, so every instance picks up rotated keys.
+func (ks *signingKeyService) Load() error {
+	config, _ := config.LoadConfig()
+	for _, purpose := range []string{models.KeyPurposeAccess, models.KeyPurposeRefresh} {
+		if err := ks.load(purpose, config); err != nil {
+			return fmt.Errorf("load %s keys: %w", purpose, err)
+		}
+	}
+	return nil
+}
+
+func (ks *signingKeyService) load(purpose string, config config.Config) error {
+	keys, err := ks.find(purpose)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		if err := ks.seed(purpose, config); err != nil {
+			return err
+		}
+		if keys, err = ks.find(purpose); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	lifetime := config.AccessTokenExpiresIn
+	if purpose == models.KeyPurposeRefresh {
+		lifetime = config.RefreshTokenExpiresIn
+	}
+
+	var active string
+	parsed := map[string]*rsa.PrivateKey{}
+	for i, key := range keys {
+		// Once the next key took over, tokens signed with this one last until
+		// they expire
+		if i+1 < len(keys) && keys[i+1].ActivatesAt.Add(lifetime).Before(now) {
+			if err := ks.db.Model(&key).Update("retired_at", now).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		private, kid, err := utils.ParseSigningKey(key.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key.Kid, err)
+		}
+		parsed[kid] = private
+		if !key.ActivatesAt.After(now) || active == "" {
+			active = kid
+		}
+	}
+
+	return keySet(purpose).SetKeys(active, parsed)
+}
+
+// seed stores the first key of a purpose: the key from the environment when
+// there is one, so tokens issued before keys were rotated stay valid, or a new
+// one
+func (ks *signingKeyService) seed(purpose string, config config.Config) error {
+	encoded := config.AccessTokenPrivateKey
+	if purpose == models.KeyPurposeRefresh {
+		encoded = config.RefreshTokenPrivateKey
+	}
+
+	privateKey := ""
+	if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil && len(decoded) > 0 {
+		privateKey = string(decoded)
+	} else if privateKey, err = utils.GenerateSigningKey(); err != nil {
+		return err
+	}
+
+	_, kid, err := utils.ParseSigningKey(privateKey)
+	if err != nil {
+		return err
+	}
+	// Instances starting together may seed the same key
+	return ks.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SigningKey{
+		Kid:         kid,
+		Purpose:     purpose,
+		PrivateKey:  privateKey,
+		ActivatesAt: time.Now(),
+	}).Error
+}
+
+// Rotate adds a new key, which starts signing tokens once every instance had
+// the time to load it
+func (ks *signingKeyService) Rotate(purpose string) (*models.SigningKey, error) {
+	if purpose != models.KeyPurposeAccess && purpose != models.KeyPurposeRefresh {
+		return nil, ErrUnknownKeyPurpose
+	}
+
+	privateKey, err := utils.GenerateSigningKey()
+	if err != nil {
+		return nil, err
+	}
+	_, kid, err := utils.ParseSigningKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := models.SigningKey{
+		Kid:         kid,
+		Purpose:     purpose,
+		PrivateKey:  privateKey,
+		ActivatesAt: time.Now().Add(keyActivationDelay),
+	}
+	if err := ks.db.Create(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, ks.Load()
+}
+
+func (ks *signingKeyService) find(purpose string) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := ks.db.Where("purpose = ? AND retired_at IS NULL", purpose).Order("activates_at, id").Find(&keys).Error
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func keySet(purpose string) *utils.KeySet {
+	if purpose == models.KeyPurposeRefresh {
+		return utils.RefreshTokenKeys
+	}
+	return utils.AccessTokenKeys
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang/config"
+	"golang/models"
+	"golang/utils"
+
+	"github.com/thanhpk/randstr"
+	"gorm.io/gorm"
+)
+
+type TodoAttachmentService interface {
+	All(todoID int) ([]*models.TodoAttachment, error)
+	FindByID(todoID int, attachmentID int) (models.TodoAttachment, error)
+	Create(todoID int, userID int, name string, content []byte) (models.TodoAttachment, error)
+	Delete(todoID int, attachmentID int) (models.TodoAttachment, error)
+	PurgeOrphaned() (int64, error)
+	OpenSigned(query url.Values) (io.ReadCloser, string, string, error)
+}
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrAttachmentType     = errors.New("files of this type can't be attached")
+)
+
+// thumbnailTypes are the content types thumbnails are made for
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+const maxAttachmentName = 255
+
+type todoAttachmentService struct {
+	db      *gorm.DB
+	storage utils.Storage
+}
+
+func NewTodoAttachmentService(db *gorm.DB, storage utils.Storage) TodoAttachmentService {
+	return &todoAttachmentService{db, storage}
+}
+
+// All returns the attachments of a todo, oldest first, with fresh signed links
+func (as *todoAttachmentService) All(todoID int) ([]*models.TodoAttachment, error) {
+	var attachments []*models.TodoAttachment
+	if err := as.db.Where("todo_id = ?", todoID).Order("id").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		if err := as.sign(attachment); err != nil {
+			return nil, err
+		}
+	}
+	return attachments, nil
+}
+
+func (as *todoAttachmentService) FindByID(todoID int, attachmentID int) (models.TodoAttachment, error) {
+	attachment, err := as.find(todoID, attachmentID)
+	if err != nil {
+		return models.TodoAttachment{}, err
+	}
+	if err := as.sign(&attachment); err != nil {
+		return models.TodoAttachment{}, err
+	}
+	return attachment, nil
+}
+
+// Create stores a file with its thumbnail when it is an image. The content type
+// is told by the content itself, whatever the name or the request say.
+func (as *todoAttachmentService) Create(todoID int, userID int, name string, content []byte) (models.TodoAttachment, error) {
+	config, err := config.LoadConfig()
+	if err != nil {
+		return models.TodoAttachment{}, err
+	}
+
+	contentType := strings.TrimSpace(strings.SplitN(http.DetectContentType(content), ";", 2)[0])
+	allowed := false
+	for _, t := range config.AttachmentTypes {
+		allowed = allowed || strings.EqualFold(t, contentType)
+	}
+	if !allowed {
+		return models.TodoAttachment{}, ErrAttachmentType
+	}
+
+	attachment := models.TodoAttachment{
+		TodoID:      &todoID,
+		Name:        attachmentName(name),
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		StorageKey:  fmt.Sprintf("todos/%d/%s", todoID, randstr.Hex(16)),
+		UserID:      &userID,
+	}
+
+	var thumbnail []byte
+	if thumbnailTypes[contentType] {
+		if thumbnail, err = utils.Thumbnail(content); err != nil {
+			return models.TodoAttachment{}, err
+		}
+		attachment.ThumbnailKey = attachment.StorageKey + "-thumbnail.jpg"
+	}
+
+	if err := as.storage.Put(attachment.StorageKey, content, contentType); err != nil {
+		return models.TodoAttachment{}, err
+	}
+	if thumbnail != nil {
+		err = as.storage.Put(attachment.ThumbnailKey, thumbnail, "image/jpeg")
+	}
+	if err == nil {
+		err = as.db.Omit("Todo", "User").Create(&attachment).Error
+	}
+	if err != nil {
+		as.deleteBlobs(attachment)
+		return models.TodoAttachment{}, err
+	}
+
+	if err := as.sign(&attachment); err != nil {
+		return models.TodoAttachment{}, err
+	}
+	return attachment, nil
+}
+
+// Delete removes an attachment with its blobs and returns it
+func (as *todoAttachmentService) Delete(todoID int, attachmentID int) (models.TodoAttachment, error) {
+	attachment, err := as.find(todoID, attachmentID)
+	if err != nil {
+		return models.TodoAttachment{}, err
+	}
+	if err := as.purge(attachment); err != nil {
+		return models.TodoAttachment{}, err
+	}
+	return attachment, nil
+}
+
+// PurgeOrphaned deletes the attachments left without a todo when it was purged,
+// blobs first so a failure leaves the row to try again
+func (as *todoAttachmentService) PurgeOrphaned() (int64, error) {
+	var attachments []models.TodoAttachment
+	if err := as.db.Where("todo_id IS NULL").Find(&attachments).Error; err != nil {
+		return 0, err
+	}
+
+	for _, attachment := range attachments {
+		if err := as.purge(attachment); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(attachments)), nil
+}
+
+// OpenSigned opens the blob a signed link of the local storage points to, and
+// returns it with the name and content type to serve it with
+func (as *todoAttachmentService) OpenSigned(query url.Values) (io.ReadCloser, string, string, error) {
+	local, ok := as.storage.(*utils.LocalStorage)
+	if !ok {
+		return nil, "", "", utils.ErrInvalidSignedURL
+	}
+	key, name, contentType, err := local.VerifyURL(query, time.Now())
+	if err != nil {
+		return nil, "", "", err
+	}
+	blob, err := local.Open(key)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return blob, name, contentType, nil
+}
+
+func (as *todoAttachmentService) find(todoID int, attachmentID int) (models.TodoAttachment, error) {
+	var attachment models.TodoAttachment
+	err := as.db.Where("id = ? AND todo_id = ?", attachmentID, todoID).Limit(1).Find(&attachment).Error
+	if err != nil {
+		return models.TodoAttachment{}, err
+	}
+	if attachment.ID == 0 {
+		return models.TodoAttachment{}, ErrAttachmentNotFound
+	}
+	return attachment, nil
+}
+
+func (as *todoAttachmentService) purge(attachment models.TodoAttachment) error {
+	if err := as.deleteBlobs(attachment); err != nil {
+		return err
+	}
+	return as.db.Delete(&attachment).Error
+}
+
+func (as *todoAttachmentService) deleteBlobs(attachment models.TodoAttachment) error {
+	if attachment.ThumbnailKey != "" {
+		if err := as.storage.Delete(attachment.ThumbnailKey); err != nil {
+			return err
+		}
+	}
+	return as.storage.Delete(attachment.StorageKey)
+}
+
+// sign fills in the links to the file and its thumbnail
+func (as *todoAttachmentService) sign(attachment *models.TodoAttachment) error {
+	config, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(config.AttachmentURLExpiresIn)
+	attachment.URL, err = as.storage.SignedURL(attachment.StorageKey, attachment.Name, attachment.ContentType, expires)
+	if err != nil {
+		return err
+	}
+	if attachment.ThumbnailKey != "" {
+		name := strings.TrimSuffix(attachment.Name, path.Ext(attachment.Name)) + "-thumbnail.jpg"
+		attachment.ThumbnailURL, err = as.storage.SignedURL(attachment.ThumbnailKey, name, "image/jpeg", expires)
+		if err != nil {
+			return err
+		}
+	}
+	attachment.URLExpiresAt = &expires
+	return nil
+}
+
+// attachmentName keeps the base of an uploaded file name, without control
+// characters and within maxAttachmentName bytes
+func attachmentName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name))
+
+	for len(name) > maxAttachmentName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang/models"
+
+	"gorm.io/gorm"
+)
+
+type TodoCommentService interface {
+	All(todoID int, query models.TodoCommentQuery) ([]*models.TodoComment, error)
+	Create(todoID int, userID int, input models.TodoCommentInput) (models.TodoComment, []*models.User, error)
+	Update(todoID int, commentID int, userID int, input models.TodoCommentInput) (models.TodoComment, []*models.User, error)
+	Delete(todoID int, commentID int, userID int) error
+}
+
+var (
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrNotCommentAuthor = errors.New("only the author may change a comment")
+)
+
+const defaultCommentLimit = 50
+
+// mentionPattern finds the users mentioned in a comment by their email, such
+// as @alice@example.com
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.@])@([\w.+-]+@[\w-]+(?:\.[\w-]+)+)`)
+
+type todoCommentService struct {
+	db *gorm.DB
+}
+
+func NewTodoCommentService(db *gorm.DB) TodoCommentService {
+	return &todoCommentService{db}
+}
+
+func (cs *todoCommentService) All(todoID int, query models.TodoCommentQuery) ([]*models.TodoComment, error) {
+	limit := query.Limit
+	if limit == 0 {
+		limit = defaultCommentLimit
+	}
+
+	var comments []*models.TodoComment
+	err := cs.db.Preload("User").Where("todo_id = ? AND id > ?", todoID, query.AfterID).Order("id").Limit(limit).Find(&comments).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, comment := range comments {
+		comment.Author = comment.User.Name
+	}
+	return comments, nil
+}
+
+// Create adds a comment and returns it with the users it mentions who may see
+// the todo
+func (cs *todoCommentService) Create(todoID int, userID int, input models.TodoCommentInput) (models.TodoComment, []*models.User, error) {
+	comment := models.TodoComment{TodoID: todoID, UserID: userID, Body: input.Body}
+	if err := cs.db.Omit("Todo", "User").Create(&comment).Error; err != nil {
+		return models.TodoComment{}, nil, err
+	}
+
+	mentioned, err := cs.mentioned(comment, "")
+	if err != nil {
+		return models.TodoComment{}, nil, err
+	}
+	return cs.reload(comment.ID, mentioned)
+}
+
+// Update changes the body of a comment of the user and returns it with the
+// users it mentions for the first time
+func (cs *todoCommentService) Update(todoID int, commentID int, userID int, input models.TodoCommentInput) (models.TodoComment, []*models.User, error) {
+	comment, err := cs.findOwn(todoID, commentID, userID)
+	if err != nil {
+		return models.TodoComment{}, nil, err
+	}
+
+	previous := comment.Body
+	now := time.Now()
+	err = cs.db.Model(&comment).Updates(map[string]interface{}{"body": input.Body, "edited_at": now}).Error
+	if err != nil {
+		return models.TodoComment{}, nil, err
+	}
+	comment.Body = input.Body
+
+	mentioned, err := cs.mentioned(comment, previous)
+	if err != nil {
+		return models.TodoComment{}, nil, err
+	}
+	return cs.reload(comment.ID, mentioned)
+}
+
+func (cs *todoCommentService) Delete(todoID int, commentID int, userID int) error {
+	comment, err := cs.findOwn(todoID, commentID, userID)
+	if err != nil {
+		return err
+	}
+	return cs.db.Delete(&comment).Error
+}
+
+func (cs *todoCommentService) findOwn(todoID int, commentID int, userID int) (models.TodoComment, error) {
+	var comment models.TodoComment
+	err := cs.db.Where("id = ? AND todo_id = ?", commentID, todoID).Limit(1).Find(&comment).Error
+	if err != nil {
+		return models.TodoComment{}, err
+	}
+	if comment.ID == 0 {
+		return models.TodoComment{}, ErrCommentNotFound
+	}
+	if comment.UserID != userID {
+		return models.TodoComment{}, ErrNotCommentAuthor
+	}
+	return comment, nil
+}
+
+func (cs *todoCommentService) reload(commentID int, mentioned []*models.User) (models.TodoComment, []*models.User, error) {
+	var comment models.TodoComment
+	if err := cs.db.Preload("User").Preload("Todo").Find(&comment, commentID).Error; err != nil {
+		return models.TodoComment{}, nil, err
+	}
+	comment.Author = comment.User.Name
+	return comment, mentioned, nil
+}
+
+// mentioned finds the users the comment mentions, leaving out the author, the
+// users mentioned in the previous body already and those who can't see the todo
+func (cs *todoCommentService) mentioned(comment models.TodoComment, previous string) ([]*models.User, error) {
+	already := map[string]bool{}
+	for _, email := range mentionedEmails(previous) {
+		already[email] = true
+	}
+	var emails []string
+	for _, email := range mentionedEmails(comment.Body) {
+		if !already[email] {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return nil, nil
+	}
+
+	var todo models.Todo
+	if err := cs.db.Find(&todo, comment.TodoID).Error; err != nil {
+		return nil, err
+	}
+
+	var users []*models.User
+	if err := cs.db.Where("email IN ? AND id <> ?", emails, comment.UserID).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	mentioned := make([]*models.User, 0, len(users))
+	for _, user := range users {
+		role, err := todoRole(cs.db, user.ID, todo)
+		if err != nil {
+			return nil, err
+		}
+		if models.RoleAtLeast(role, models.RoleViewer) {
+			mentioned = append(mentioned, user)
+		}
+	}
+	return mentioned, nil
+}
+
+func mentionedEmails(body string) []string {
+	seen := map[string]bool{}
+	var emails []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		email := strings.ToLower(match[1])
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+	return emails
+}
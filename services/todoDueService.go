@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"golang/models"
+
+	"gorm.io/gorm"
+)
+
+// resolveDue reads the due input of a todo. A date becomes an all-day due date,
+// stored as midnight UTC so it stays the same calendar day in every timezone. A
+// datetime without an offset of its own is read in the due timezone.
+func resolveDue(todo *models.Todo, due string, timezone string) error {
+	todo.DueDate, todo.DueAllDay, todo.DueTimezone = nil, false, timezone
+	if due == "" {
+		return nil
+	}
+
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("%w: unknown timezone %q", ErrInvalidDue, timezone)
+		}
+	}
+
+	if date, err := time.Parse("2006-01-02", due); err == nil {
+		todo.DueDate, todo.DueAllDay = &date, true
+		return nil
+	}
+	if instant, err := time.Parse(time.RFC3339, due); err == nil {
+		todo.DueDate = &instant
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if local, err := time.ParseInLocation(layout, due, loc); err == nil {
+			todo.DueDate = &local
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q is neither a date nor a datetime", ErrInvalidDue, due)
+}
+
+// dueInstant is the moment a todo is due, all-day todos being due at the start
+// of their day in the due timezone
+func dueInstant(todo models.Todo) *time.Time {
+	if todo.DueDate == nil || !todo.DueAllDay {
+		return todo.DueDate
+	}
+
+	loc, err := time.LoadLocation(todo.DueTimezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	year, month, day := todo.DueDate.UTC().Date()
+	instant := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	return &instant
+}
+
+func remindAt(todo models.Todo, reminder models.TodoReminder) *time.Time {
+	if reminder.At != nil {
+		return reminder.At
+	}
+	due := dueInstant(todo)
+	if due == nil || reminder.OffsetMinutes == nil {
+		return nil
+	}
+	at := due.Add(time.Duration(*reminder.OffsetMinutes) * time.Minute)
+	return &at
+}
+
+// setReminders replaces the reminders of a todo
+func setReminders(tx *gorm.DB, todo models.Todo, inputs []models.TodoReminderInput) error {
+	if err := tx.Where("todo_id = ?", todo.ID).Delete(&models.TodoReminder{}).Error; err != nil {
+		return err
+	}
+
+	for _, input := range inputs {
+		if (input.At == nil) == (input.OffsetMinutes == nil) {
+			return fmt.Errorf("%w: a reminder needs either at or offsetMinutes", ErrInvalidDue)
+		}
+		reminder := models.TodoReminder{TodoID: todo.ID, At: input.At, OffsetMinutes: input.OffsetMinutes}
+		reminder.RemindAt = remindAt(todo, reminder)
+		if err := tx.Create(&reminder).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyReminders maps the single reminder older clients set onto the reminders
+// that are actually sent, none when it is cleared
+func legacyReminders(reminder *time.Time) []models.TodoReminderInput {
+	if reminder == nil {
+		return nil
+	}
+	return []models.TodoReminderInput{{At: reminder}}
+}
+
+// refreshReminders resolves offset reminders again after the due date changed
+func refreshReminders(tx *gorm.DB, todo models.Todo) error {
+	var reminders []models.TodoReminder
+	if err := tx.Where("todo_id = ? AND offset_minutes IS NOT NULL", todo.ID).Find(&reminders).Error; err != nil {
+		return err
+	}
+
+	for _, reminder := range reminders {
+		err := tx.Model(&reminder).Update("remind_at", remindAt(todo, reminder)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Today lists the open todos due on the current day in the given timezone
+func (ts *todoService) Today(userID int, loc *time.Location, now time.Time) ([]*models.Todo, error) {
+	date, start, end := dayBounds(now, loc, 1)
+	return ts.dueTodos(userID, "(due_all_day AND due_date = ?) OR (NOT due_all_day AND due_date >= ? AND due_date < ?)", date, start, end)
+}
+
+// Upcoming lists the open todos due within the given number of days after today,
+// by default until the end of the week
+func (ts *todoService) Upcoming(userID int, loc *time.Location, weekStart time.Weekday, now time.Time, days int) ([]*models.Todo, error) {
+	date, _, tomorrow := dayBounds(now, loc, 1)
+	if days == 0 {
+		days = daysLeftInWeek(date, weekStart)
+	}
+	_, _, end := dayBounds(now, loc, days+1)
+	return ts.dueTodos(userID, "(due_all_day AND due_date > ? AND due_date <= ?) OR (NOT due_all_day AND due_date >= ? AND due_date < ?)", date, date.AddDate(0, 0, days), tomorrow, end)
+}
+
+// Overdue lists the open todos whose due date has passed
+func (ts *todoService) Overdue(userID int, loc *time.Location, now time.Time) ([]*models.Todo, error) {
+	date, _, _ := dayBounds(now, loc, 1)
+	return ts.dueTodos(userID, "(due_all_day AND due_date < ?) OR (NOT due_all_day AND due_date < ?)", date, now)
+}
+
+func (ts *todoService) dueTodos(userID int, condition string, args ...interface{}) ([]*models.Todo, error) {
+	var todos []*models.Todo
+	err := ts.db.Preload("User").Preload("Color").Preload("Reminders").
+		Where("user_id = ? OR todo_list_id IN (?)", userID, sharedTodoListIDs(ts.db, userID)).
+		Where("NOT completed AND due_date IS NOT NULL").
+		Where(condition, args...).
+		Order("due_date").Order(positionOrder).Find(&todos).Error
+	if err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// dayBounds returns the current calendar day as stored for all-day due dates, and
+// the instants the day starts and the given number of days later ends in loc
+func dayBounds(now time.Time, loc *time.Location, days int) (time.Time, time.Time, time.Time) {
+	year, month, day := now.In(loc).Date()
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	return date, start, time.Date(year, month, day+days, 0, 0, 0, 0, loc)
+}
+
+// daysLeftInWeek counts the days after the date until the end of its week, which
+// starts on weekStart. On the last day of a week it counts the next week.
+func daysLeftInWeek(date time.Time, weekStart time.Weekday) int {
+	days := (int(weekStart) - int(date.Weekday()) + 6) % 7
+	if days == 0 {
+		return 7
+	}
+	return days
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDaysLeftInWeek(t *testing.T) {
+	// 2024-03-04 is a monday
+	monday := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		date      time.Time
+		weekStart time.Weekday
+		days      int
+	}{
+		{monday, time.Monday, 6},
+		{monday.AddDate(0, 0, 5), time.Monday, 1},
+		{monday.AddDate(0, 0, 6), time.Monday, 7},
+		{monday, time.Sunday, 5},
+		{monday.AddDate(0, 0, 5), time.Sunday, 7},
+		{monday, time.Saturday, 4},
+		{monday.AddDate(0, 0, 4), time.Saturday, 7},
+	}
+	for _, test := range tests {
+		if days := daysLeftInWeek(test.date, test.weekStart); days != test.days {
+			t.Errorf("%s with weeks starting on %s: got %d, want %d", test.date.Weekday(), test.weekStart, days, test.days)
+		}
+	}
+}
+
+func TestNormalizeRecurrenceWeekStart(t *testing.T) {
+	tests := []struct {
+		rule      string
+		weekStart time.Weekday
+		want      string
+	}{
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU", time.Sunday, "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;WKST=SU"},
+		{"FREQ=WEEKLY;WKST=MO", time.Sunday, "FREQ=WEEKLY;WKST=MO"},
+		{"FREQ=DAILY", time.Sunday, "FREQ=DAILY"},
+		{"", time.Sunday, ""},
+	}
+	for _, test := range tests {
+		got, err := normalizeRecurrence(test.rule, test.weekStart)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.rule, got, test.want)
+		}
+	}
+}
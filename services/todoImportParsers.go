@@ -0,0 +1,312 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang/models"
+	"golang/utils"
+)
+
+// importRow is a todo read from an import file, before its color is resolved.
+// Completed todos are skipped.
+type importRow struct {
+	Row   int
+	Input models.TodoInput
+	Color string
+	Skip  bool
+	Err   error
+}
+
+var importFields = map[string]bool{
+	"title": true, "isi": true, "reminder": true, "due": true, "dueTimezone": true,
+	"color": true, "tags": true, "recurrence": true,
+}
+
+// importHeaderAliases maps common CSV headers of other tools onto todo fields
+var importHeaderAliases = map[string]string{
+	"title": "title", "name": "title", "task": "title", "summary": "title", "subject": "title",
+	"isi": "isi", "description": "isi", "notes": "isi", "note": "isi", "content": "isi",
+	"reminder": "reminder", "remind": "reminder",
+	"due": "due", "due date": "due", "duedate": "due", "deadline": "due",
+	"timezone": "dueTimezone", "due timezone": "dueTimezone", "duetimezone": "dueTimezone",
+	"color": "color", "colour": "color",
+	"tags": "tags", "labels": "tags", "tag": "tags", "label": "tags",
+	"recurrence": "recurrence", "rrule": "recurrence", "repeat": "recurrence",
+}
+
+func parseImport(format string, content string, mapping models.TodoImportMapping) ([]importRow, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	switch format {
+	case models.ImportFormatICS:
+		return parseICSImport(content)
+	case models.ImportFormatCSV:
+		return parseCSVImport(content, mapping)
+	case models.ImportFormatTodoTxt:
+		return parseTodoTxtImport(content), nil
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+// parseICSImport reads the VTODO components of a calendar. Each component is a
+// row, numbered in the order of the file.
+func parseICSImport(content string) ([]importRow, error) {
+	components, err := utils.ParseICal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []importRow
+	for _, calendar := range components {
+		for _, component := range calendar.Components {
+			if component.Name != "VTODO" {
+				continue
+			}
+			row := importRow{Row: len(rows) + 1}
+			row.Err = readVTodo(component, &row)
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func readVTodo(component *utils.ICalComponent, row *importRow) error {
+	if status, ok := component.Get("STATUS"); ok && strings.ToUpper(status.Value) == "COMPLETED" {
+		row.Skip = true
+		return nil
+	}
+
+	for _, property := range component.Properties {
+		switch property.Name {
+		case "SUMMARY":
+			row.Input.Title = property.Text()
+		case "DESCRIPTION":
+			row.Input.Isi = property.Text()
+		case "CATEGORIES":
+			row.Input.Tags = append(row.Input.Tags, splitTags(property.Text())...)
+		case "COLOR":
+			row.Color = property.Value
+		case "RRULE":
+			row.Input.Recurrence = property.Value
+		case "DUE":
+			due, timezone, err := icalDue(property)
+			if err != nil {
+				return err
+			}
+			row.Input.Due, row.Input.DueTimezone = due, timezone
+		}
+	}
+
+	for _, alarm := range component.Components {
+		if alarm.Name != "VALARM" {
+			continue
+		}
+		trigger, ok := alarm.Get("TRIGGER")
+		if !ok {
+			continue
+		}
+		if trigger.Params["VALUE"] == "DATE-TIME" {
+			at, err := time.Parse("20060102T150405Z", trigger.Value)
+			if err != nil {
+				return fmt.Errorf("invalid alarm trigger %q", trigger.Value)
+			}
+			row.Input.ReminderInputs = append(row.Input.ReminderInputs, models.TodoReminderInput{At: &at})
+			continue
+		}
+		offset, err := utils.ParseICalDuration(trigger.Value)
+		if err != nil {
+			return err
+		}
+		minutes := int(offset / time.Minute)
+		row.Input.ReminderInputs = append(row.Input.ReminderInputs, models.TodoReminderInput{OffsetMinutes: &minutes})
+	}
+	return nil
+}
+
+// icalDue turns a DUE property into the due input of a todo
+func icalDue(property utils.ICalProperty) (string, string, error) {
+	value := property.Value
+	if property.Params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		date, err := time.Parse("20060102", value)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid due date %q", value)
+		}
+		return date.Format("2006-01-02"), "", nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		instant, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid due date %q", value)
+		}
+		return instant.Format(time.RFC3339), "", nil
+	}
+	local, err := time.Parse("20060102T150405", value)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid due date %q", value)
+	}
+	return local.Format("2006-01-02T15:04:05"), property.Params["TZID"], nil
+}
+
+// parseCSVImport reads a CSV file whose first line is a header. Columns are mapped
+// onto todo fields by the given mapping, or by their header when there is none.
+func parseCSVImport(content string, mapping models.TodoImportMapping) ([]importRow, error) {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	if header, _, _ := strings.Cut(content, "\n"); strings.Count(header, ";") > strings.Count(header, ",") {
+		reader.Comma = ';'
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the CSV header: %w", err)
+	}
+
+	columns := make([]string, len(header))
+	mapped := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		field, ok := mapping[name]
+		if len(mapping) == 0 {
+			field, ok = importHeaderAliases[strings.ToLower(name)]
+		}
+		if ok {
+			columns[i] = field
+			mapped[field] = true
+		}
+	}
+	if !mapped["title"] {
+		return nil, errors.New("no CSV column maps to title")
+	}
+
+	var rows []importRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		row := importRow{Row: line}
+		if err != nil {
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		for i, value := range record {
+			if i >= len(columns) || columns[i] == "" {
+				continue
+			}
+			if err := setImportField(&row, columns[i], strings.TrimSpace(value)); err != nil && row.Err == nil {
+				row.Err = err
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func setImportField(row *importRow, field string, value string) error {
+	if value == "" {
+		return nil
+	}
+	switch field {
+	case "title":
+		row.Input.Title = value
+	case "isi":
+		row.Input.Isi = value
+	case "due":
+		row.Input.Due = value
+	case "dueTimezone":
+		row.Input.DueTimezone = value
+	case "color":
+		row.Color = value
+	case "tags":
+		row.Input.Tags = append(row.Input.Tags, splitTags(value)...)
+	case "recurrence":
+		row.Input.Recurrence = value
+	case "reminder":
+		reminder, err := parseImportTime(value)
+		if err != nil {
+			return err
+		}
+		row.Input.Reminder = &reminder
+	}
+	return nil
+}
+
+// parseTodoTxtImport reads the todo.txt format: one todo per line, +project and
+// @context words become tags and due:, reminder: and color: set those fields.
+// The priority is kept as a priority:X tag.
+func parseTodoTxtImport(content string) []importRow {
+	var rows []importRow
+	for i, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		row := importRow{Row: i + 1}
+		if strings.HasPrefix(line, "x ") {
+			row.Skip = true
+			rows = append(rows, row)
+			continue
+		}
+
+		words := strings.Fields(line)
+		if len(words[0]) == 3 && words[0][0] == '(' && words[0][2] == ')' && words[0][1] >= 'A' && words[0][1] <= 'Z' {
+			row.Input.Tags = append(row.Input.Tags, "priority:"+string(words[0][1]))
+			words = words[1:]
+		}
+		if len(words) > 0 {
+			if _, err := time.Parse("2006-01-02", words[0]); err == nil {
+				words = words[1:]
+			}
+		}
+
+		var title []string
+		for _, word := range words {
+			key, value, found := strings.Cut(word, ":")
+			switch {
+			case len(word) > 1 && (word[0] == '+' || word[0] == '@'):
+				row.Input.Tags = append(row.Input.Tags, word[1:])
+			case found && value != "" && (key == "due" || key == "color"):
+				setImportField(&row, key, value)
+			case found && value != "" && (key == "reminder" || key == "rem"):
+				if err := setImportField(&row, "reminder", value); err != nil && row.Err == nil {
+					row.Err = err
+				}
+			default:
+				title = append(title, word)
+			}
+		}
+		row.Input.Title = strings.Join(title, " ")
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func splitTags(value string) models.Tags {
+	var tags models.Tags
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseImportTime reads a reminder, times without an offset being UTC
+func parseImportTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid reminder %q", value)
+}
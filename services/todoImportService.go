@@ -0,0 +1,293 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang/models"
+
+	"gorm.io/gorm"
+)
+
+type TodoImportService interface {
+	Create(userID int, input models.TodoImportInput, filename string, content string) (models.TodoImport, error)
+	FindByID(importID int, userID int) (models.TodoImport, error)
+	RunPending() (int, error)
+}
+
+var ErrInvalidImport = errors.New("invalid import")
+
+const (
+	// maxImportRows bounds the size of a single import
+	maxImportRows = 10000
+	// importPreviewSize is the number of todos a dry run shows
+	importPreviewSize = 100
+	// importProgressEvery is how many rows a dry run processes between progress
+	// updates. Other runs record their progress with every todo they create.
+	importProgressEvery = 50
+	// importStaleAfter is how long a running import may go without progress
+	// before it's considered abandoned, e.g. by a restart, and run again
+	importStaleAfter = 15 * time.Minute
+)
+
+type todoImportService struct {
+	db *gorm.DB
+}
+
+func NewTodoImportService(db *gorm.DB) TodoImportService {
+	return &todoImportService{db}
+}
+
+// Create stores an import job and starts it in the background. The format is taken
+// from the file extension unless given.
+func (is *todoImportService) Create(userID int, input models.TodoImportInput, filename string, content string) (models.TodoImport, error) {
+	format := input.Format
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".ics", ".ical", ".ifb":
+			format = models.ImportFormatICS
+		case ".csv":
+			format = models.ImportFormatCSV
+		case ".txt":
+			format = models.ImportFormatTodoTxt
+		default:
+			return models.TodoImport{}, fmt.Errorf("%w: cannot tell the format of %q", ErrInvalidImport, filename)
+		}
+	}
+
+	var mapping models.TodoImportMapping
+	if input.Mapping != "" {
+		if err := json.Unmarshal([]byte(input.Mapping), &mapping); err != nil {
+			return models.TodoImport{}, fmt.Errorf("%w: mapping must be a JSON object of column names to fields", ErrInvalidImport)
+		}
+		for column, field := range mapping {
+			if !importFields[field] {
+				return models.TodoImport{}, fmt.Errorf("%w: column %q maps to unknown field %q", ErrInvalidImport, column, field)
+			}
+		}
+	}
+
+	if err := checkList(is.db, userID, input.TodoListID); err != nil {
+		return models.TodoImport{}, err
+	}
+
+	job := models.TodoImport{
+		Format:     format,
+		Filename:   filename,
+		DryRun:     input.DryRun,
+		Status:     models.ImportPending,
+		Content:    content,
+		Mapping:    mapping,
+		TodoListID: input.TodoListID,
+		UserID:     userID,
+	}
+	if err := is.db.Create(&job).Error; err != nil {
+		return models.TodoImport{}, err
+	}
+
+	go func() {
+		if err := is.run(job.ID); err != nil {
+			log.Println("import", job.ID, "failed:", err)
+		}
+	}()
+	return job, nil
+}
+
+func (is *todoImportService) FindByID(importID int, userID int) (models.TodoImport, error) {
+	var job models.TodoImport
+	err := is.db.Where("user_id = ?", userID).First(&job, importID).Error
+	if err != nil {
+		return models.TodoImport{}, err
+	}
+	return job, nil
+}
+
+// RunPending runs the imports that never started or were abandoned mid-way
+func (is *todoImportService) RunPending() (int, error) {
+	var ids []int
+	err := is.db.Model(&models.TodoImport{}).
+		Where("status = ? OR (status = ? AND updated_at < ?)", models.ImportPending, models.ImportRunning, time.Now().Add(-importStaleAfter)).
+		Where("created_at < ?", time.Now().Add(-time.Minute)).
+		Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := is.run(id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// run claims an import and processes its rows. An abandoned run is resumed after
+// the last progress it recorded, which is saved in the transaction creating each
+// todo so a resumed run never creates one twice.
+func (is *todoImportService) run(importID int) error {
+	var job models.TodoImport
+	if err := is.db.First(&job, importID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	claim := is.db.Model(&models.TodoImport{}).
+		Where("id = ? AND status = ? AND (updated_at IS NULL OR updated_at = ?)", job.ID, job.Status, job.UpdatedAt).
+		Updates(map[string]interface{}{"status": models.ImportRunning, "started_at": now})
+	if claim.Error != nil {
+		return claim.Error
+	}
+	if claim.RowsAffected == 0 || (job.Status != models.ImportPending && job.Status != models.ImportRunning) {
+		return nil
+	}
+
+	rows, err := parseImport(job.Format, job.Content, job.Mapping)
+	if err == nil && len(rows) > maxImportRows {
+		err = fmt.Errorf("the file has %d todos, at most %d can be imported at once", len(rows), maxImportRows)
+	}
+	if err != nil {
+		return is.finish(&job, models.ImportFailed, models.TodoImportErrors{{Row: 0, Error: err.Error()}})
+	}
+
+	colors, err := importColors(is.db)
+	if err != nil {
+		return err
+	}
+
+	job.Total = len(rows)
+	for i := job.Processed; i < len(rows); i++ {
+		row := rows[i]
+		if job.DryRun {
+			processImportRow(&job, row, colors, nil)
+			job.Processed++
+			if job.Processed%importProgressEvery == 0 {
+				if err := saveImportProgress(is.db, &job); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err := is.db.Transaction(func(tx *gorm.DB) error {
+			processImportRow(&job, row, colors, NewTodoService(tx))
+			job.Processed++
+			return saveImportProgress(tx, &job)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return is.finish(&job, models.ImportCompleted, job.Errors)
+}
+
+func saveImportProgress(db *gorm.DB, job *models.TodoImport) error {
+	return db.Model(job).Select("total", "processed", "imported", "skipped", "failed", "errors", "preview").Updates(job).Error
+}
+
+// processImportRow imports a row with the todo service, or only validates it in a dry run
+func processImportRow(job *models.TodoImport, row importRow, colors map[string]int, todoService TodoService) {
+	fail := func(err error) {
+		job.Failed++
+		job.Errors = append(job.Errors, models.TodoImportError{Row: row.Row, Error: err.Error()})
+	}
+
+	if row.Skip {
+		job.Skipped++
+		return
+	}
+	if row.Err != nil {
+		fail(row.Err)
+		return
+	}
+
+	input := row.Input
+	input.UserID = job.UserID
+	input.TodoListID = job.TodoListID
+	if strings.TrimSpace(input.Title) == "" {
+		fail(errors.New("title is required"))
+		return
+	}
+	if row.Color != "" {
+		colorID, ok := colors[colorKey(row.Color)]
+		if !ok {
+			fail(fmt.Errorf("%w: %q", ErrColorNotFound, row.Color))
+			return
+		}
+		input.ColorID = &colorID
+	}
+
+	if job.DryRun {
+		if err := validateImport(input); err != nil {
+			fail(err)
+			return
+		}
+		if len(job.Preview) < importPreviewSize {
+			job.Preview = append(job.Preview, input)
+		}
+		job.Imported++
+		return
+	}
+
+	if _, err := todoService.Insert(input); err != nil {
+		fail(err)
+		return
+	}
+	job.Imported++
+}
+
+// finish records the outcome of an import and drops the uploaded file
+func (is *todoImportService) finish(job *models.TodoImport, status string, rowErrors models.TodoImportErrors) error {
+	now := time.Now()
+	job.Status, job.Errors, job.Content, job.FinishedAt = status, rowErrors, "", &now
+	return is.db.Model(job).
+		Select("status", "total", "processed", "imported", "skipped", "failed", "errors", "preview", "content", "finished_at").
+		Updates(job).Error
+}
+
+// validateImport runs the checks Insert would, without creating the todo
+func validateImport(input models.TodoInput) error {
+	var todo models.Todo
+	if err := resolveDue(&todo, input.Due, input.DueTimezone); err != nil {
+		return err
+	}
+	_, err := normalizeRecurrence(input.Recurrence, time.Monday)
+	return err
+}
+
+// importColors indexes the colors by name and by code, so a file may refer to
+// either
+func importColors(db *gorm.DB) (map[string]int, error) {
+	var colors []models.Color
+	if err := db.Find(&colors).Error; err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for _, color := range colors {
+		if color.ColorCode != nil {
+			index[colorKey(*color.ColorCode)] = color.ID
+		}
+		if color.ColorName != nil {
+			index[colorKey(*color.ColorName)] = color.ID
+		}
+	}
+	return index, nil
+}
+
+// colorKey normalizes a color name or hex code, #ABC matching #aabbcc
+func colorKey(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 && strings.Trim(hex, "0123456789abcdef") == "" {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if (len(hex) == 6 || len(hex) == 8) && strings.Trim(hex, "0123456789abcdef") == "" {
+		return "#" + hex
+	}
+	return value
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"time"
+
+	"golang/models"
+	"golang/utils"
+
+	"github.com/mashingan/smapping"
+	"gorm.io/gorm"
+)
+
+type TodoListService interface {
+	All(userID int, archived bool) ([]*models.TodoList, error)
+	FindByID(todoListID int) (models.TodoList, error)
+	Insert(l models.TodoListInput) (models.TodoList, error)
+	Update(todoListID int, l models.TodoListInput) (models.TodoList, error)
+	Delete(l models.TodoList, input models.TodoListDeleteInput) error
+	Move(todoListID int, userID int, input models.MoveInput) (models.TodoList, error)
+}
+
+type todoListService struct {
+	db *gorm.DB
+}
+
+func NewTodoListService(db *gorm.DB) TodoListService {
+	return &todoListService{db}
+}
+
+func (ls *todoListService) All(userID int, archived bool) ([]*models.TodoList, error) {
+	var todoLists []*models.TodoList
+	err := ls.db.Preload("Color").Where("user_id = ? OR id IN (?)", userID, sharedTodoListIDs(ls.db, userID)).Where("archived = ?", archived).Order(positionOrder).Order("id").Find(&todoLists).Error
+	if err != nil {
+		return nil, err
+	}
+	return todoLists, nil
+}
+
+func (ls *todoListService) FindByID(todoListID int) (models.TodoList, error) {
+	var todoList models.TodoList
+	err := ls.db.Preload("Color").Find(&todoList, todoListID).Error
+	if err != nil {
+		return models.TodoList{}, err
+	}
+	return todoList, nil
+}
+
+func (ls *todoListService) Insert(l models.TodoListInput) (models.TodoList, error) {
+	var todoList models.TodoList
+	err := smapping.FillStruct(&todoList, smapping.MapFields(&l))
+	if err != nil {
+		return models.TodoList{}, err
+	}
+
+	last, err := lastPosition(ls.db, &models.TodoList{}, l.UserID)
+	if err != nil {
+		return models.TodoList{}, err
+	}
+	todoList.Position = utils.RankAfter(last)
+
+	err = ls.db.Save(&todoList).Error
+	if err != nil {
+		return models.TodoList{}, err
+	}
+
+	err = ls.db.Preload("Color").Find(&todoList).Error
+	if err != nil {
+		return models.TodoList{}, err
+	}
+	return todoList, nil
+}
+
+func (ls *todoListService) Update(todoListID int, l models.TodoListInput) (models.TodoList, error) {
+	err := ls.db.Model(&models.TodoList{}).Where("id = ?", todoListID).Updates(map[string]interface{}{
+		"name":     l.Name,
+		"archived": l.Archived,
+		"color_id": l.ColorID,
+	}).Error
+	if err != nil {
+		return models.TodoList{}, err
+	}
+
+	return ls.FindByID(todoListID)
+}
+
+// Delete removes a list together with its todos, which are either moved to the
+// target list or trashed depending on the input. Todos in the trash already
+// leave the list too.
+func (ls *todoListService) Delete(l models.TodoList, input models.TodoListDeleteInput) error {
+	return ls.db.Transaction(func(tx *gorm.DB) error {
+		if input.Todos == "trash" {
+			err := tx.Model(&models.Todo{}).Where("todo_list_id = ?", l.ID).Update("deleted_at", time.Now()).Error
+			if err != nil {
+				return err
+			}
+			// Trashed todos leave the list so a restore doesn't put them in a deleted one
+			err = tx.Model(&models.Todo{}).Unscoped().Where("todo_list_id = ?", l.ID).Update("todo_list_id", nil).Error
+			if err != nil {
+				return err
+			}
+		} else {
+			if input.TargetID != nil && *input.TargetID == l.ID {
+				return ErrListNotFound
+			}
+			if err := checkList(tx, l.UserID, input.TargetID); err != nil {
+				return err
+			}
+			err := tx.Model(&models.Todo{}).Unscoped().Where("todo_list_id = ?", l.ID).Update("todo_list_id", input.TargetID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&l).Error
+	})
+}
+
+func (ls *todoListService) Move(todoListID int, userID int, input models.MoveInput) (models.TodoList, error) {
+	err := movePosition(ls.db, &models.TodoList{}, todoListID, userID, input)
+	if err != nil {
+		return models.TodoList{}, err
+	}
+	return ls.FindByID(todoListID)
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"golang/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TodoListShareService interface {
+	All(todoListID int) ([]*models.TodoListShare, error)
+	Invitations(userID int) ([]*models.TodoListShare, error)
+	FindByID(shareID int) (models.TodoListShare, error)
+	FindByToken(token string) (models.TodoListShare, error)
+	Invite(share models.TodoListShare) (models.TodoListShare, error)
+	UpdateRole(shareID int, role string) (models.TodoListShare, error)
+	Respond(share models.TodoListShare, accept bool) (models.TodoListShare, error)
+	Delete(share models.TodoListShare) error
+}
+
+type todoListShareService struct {
+	db *gorm.DB
+}
+
+func NewTodoListShareService(db *gorm.DB) TodoListShareService {
+	return &todoListShareService{db}
+}
+
+func (ss *todoListShareService) All(todoListID int) ([]*models.TodoListShare, error) {
+	var shares []*models.TodoListShare
+	err := ss.db.Where("todo_list_id = ?", todoListID).Order("id").Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (ss *todoListShareService) Invitations(userID int) ([]*models.TodoListShare, error) {
+	var shares []*models.TodoListShare
+	err := ss.db.Preload("TodoList").Where("user_id = ? AND status = ?", userID, models.SharePending).Order("id").Find(&shares).Error
+	if err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (ss *todoListShareService) FindByID(shareID int) (models.TodoListShare, error) {
+	var share models.TodoListShare
+	err := ss.db.Find(&share, shareID).Error
+	if err != nil {
+		return models.TodoListShare{}, err
+	}
+	return share, nil
+}
+
+func (ss *todoListShareService) FindByToken(token string) (models.TodoListShare, error) {
+	var share models.TodoListShare
+	err := ss.db.Preload("TodoList").Where("token = ?", token).First(&share).Error
+	if err != nil {
+		return models.TodoListShare{}, err
+	}
+	return share, nil
+}
+
+// Invite creates a pending share, or turns an existing share of the same list and
+// user back into a pending invitation with the new role and token
+func (ss *todoListShareService) Invite(share models.TodoListShare) (models.TodoListShare, error) {
+	share.Status = models.SharePending
+	err := ss.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "todo_list_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email", "role", "status", "token", "invited_by_id", "updated_at"}),
+	}).Create(&share).Error
+	if err != nil {
+		return models.TodoListShare{}, err
+	}
+
+	err = ss.db.Where("todo_list_id = ? AND user_id = ?", share.TodoListID, share.UserID).First(&share).Error
+	if err != nil {
+		return models.TodoListShare{}, err
+	}
+	return share, nil
+}
+
+func (ss *todoListShareService) UpdateRole(shareID int, role string) (models.TodoListShare, error) {
+	err := ss.db.Model(&models.TodoListShare{}).Where("id = ?", shareID).Update("role", role).Error
+	if err != nil {
+		return models.TodoListShare{}, err
+	}
+	return ss.FindByID(shareID)
+}
+
+func (ss *todoListShareService) Respond(share models.TodoListShare, accept bool) (models.TodoListShare, error) {
+	status := models.ShareDeclined
+	if accept {
+		status = models.ShareAccepted
+	}
+
+	err := ss.db.Model(&models.TodoListShare{}).Where("id = ?", share.ID).Updates(map[string]interface{}{"status": status, "token": ""}).Error
+	if err != nil {
+		return models.TodoListShare{}, err
+	}
+	return ss.FindByID(share.ID)
+}
+
+func (ss *todoListShareService) Delete(share models.TodoListShare) error {
+	err := ss.db.Delete(&share).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"golang/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TodoRevisionService interface {
+	All(todoID int) ([]*models.TodoRevision, error)
+	Diff(todoID int, from int, to int) (models.TodoRevisionDiff, error)
+	Restore(todoID int, number int, authorID int) (models.Todo, error)
+}
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+type todoRevisionService struct {
+	db *gorm.DB
+}
+
+func NewTodoRevisionService(db *gorm.DB) TodoRevisionService {
+	return &todoRevisionService{db}
+}
+
+// All returns the revisions of a todo, latest first
+func (rs *todoRevisionService) All(todoID int) ([]*models.TodoRevision, error) {
+	var revisions []*models.TodoRevision
+	err := rs.db.Where("todo_id = ?", todoID).Order("number desc").Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Diff lists the fields changed between two revisions of a todo
+func (rs *todoRevisionService) Diff(todoID int, from int, to int) (models.TodoRevisionDiff, error) {
+	fromRevision, err := rs.find(todoID, from)
+	if err != nil {
+		return models.TodoRevisionDiff{}, err
+	}
+	toRevision, err := rs.find(todoID, to)
+	if err != nil {
+		return models.TodoRevisionDiff{}, err
+	}
+
+	changes, err := changedFields(fromRevision.TodoSnapshot, toRevision.TodoSnapshot)
+	if err != nil {
+		return models.TodoRevisionDiff{}, err
+	}
+	if changes == nil {
+		changes = models.FieldChanges{}
+	}
+	return models.TodoRevisionDiff{From: from, To: to, Changes: changes}, nil
+}
+
+// Restore brings a todo back to the state of one of its revisions, which is
+// kept as a new revision
+func (rs *todoRevisionService) Restore(todoID int, number int, authorID int) (models.Todo, error) {
+	revision, err := rs.find(todoID, number)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	err = rs.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkList(tx, authorID, revision.TodoListID); err != nil {
+			return err
+		}
+
+		return withRevision(tx, todoID, authorID, func() error {
+			var todo models.Todo
+			if err := tx.Find(&todo, todoID).Error; err != nil {
+				return err
+			}
+
+			previousRecurrence := todo.Recurrence
+			snapshot := revision.TodoSnapshot
+			todo.Title, todo.Isi, todo.Tags = snapshot.Title, snapshot.Isi, snapshot.Tags
+			todo.Reminder, todo.DueDate, todo.DueAllDay, todo.DueTimezone = snapshot.Reminder, snapshot.DueDate, snapshot.DueAllDay, snapshot.DueTimezone
+			todo.ColorID, todo.TodoListID = snapshot.ColorID, snapshot.TodoListID
+			todo.Recurrence = snapshot.Recurrence
+			if todo.Recurrence != previousRecurrence {
+				startRecurrence(&todo)
+			}
+			if !snapshot.Completed {
+				todo.CompletedAt = nil
+			} else if !todo.Completed {
+				now := time.Now()
+				todo.CompletedAt = &now
+			}
+			todo.Completed = snapshot.Completed
+
+			if err := tx.Omit(clause.Associations).Save(&todo).Error; err != nil {
+				return err
+			}
+			return refreshReminders(tx, todo)
+		})
+	})
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	var todo models.Todo
+	err = rs.db.Preload("User").Preload("Color").Preload("Reminders").Find(&todo, todoID).Error
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return todo, nil
+}
+
+func (rs *todoRevisionService) find(todoID int, number int) (models.TodoRevision, error) {
+	var revision models.TodoRevision
+	err := rs.db.Where("todo_id = ? AND number = ?", todoID, number).Limit(1).Find(&revision).Error
+	if err != nil {
+		return models.TodoRevision{}, err
+	}
+	if revision.ID == 0 {
+		return models.TodoRevision{}, ErrRevisionNotFound
+	}
+	return revision, nil
+}
+
+// withRevision runs a change of a todo by the author, keeping a revision of the
+// state before it when that state has none yet, and one of the state after it
+func withRevision(tx *gorm.DB, todoID int, authorID int, change func() error) error {
+	if err := recordRevision(tx, todoID, nil); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	return recordRevision(tx, todoID, &authorID)
+}
+
+// recordRevision stores the state of a todo as its next revision, unless the
+// latest revision has that state already
+func recordRevision(tx *gorm.DB, todoID int, authorID *int) error {
+	// The lock orders concurrent changes, so revision numbers don't collide
+	var todo models.Todo
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Find(&todo, todoID).Error
+	if err != nil {
+		return err
+	}
+	if todo.ID != todoID {
+		return nil
+	}
+
+	var latest models.TodoRevision
+	if err := tx.Where("todo_id = ?", todoID).Order("number desc").Limit(1).Find(&latest).Error; err != nil {
+		return err
+	}
+	snapshot := todo.Snapshot()
+	if latest.ID != 0 {
+		changes, err := changedFields(latest.TodoSnapshot, snapshot)
+		if err != nil {
+			return err
+		}
+		if changes == nil {
+			return nil
+		}
+	}
+
+	return tx.Omit(clause.Associations).Create(&models.TodoRevision{
+		TodoID:       todoID,
+		Number:       latest.Number + 1,
+		TodoSnapshot: snapshot,
+		AuthorID:     authorID,
+	}).Error
+}
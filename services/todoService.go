@@ -1,21 +1,47 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"golang/models"
+	"golang/utils"
 
 	"github.com/mashingan/smapping"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type TodoService interface {
-	All(int) ([]*models.Todo, error)
+	All(userID int, filter models.TodoFilter) ([]*models.Todo, error)
 	FindByID(todoID int, userID int) (models.Todo, error)
 	Insert(t models.TodoInput) (models.Todo, error)
-	Update(todoID int, t models.TodoInput) (models.Todo, error)
+	Update(todoID int, authorID int, t models.TodoInput) (models.Todo, error)
 	Delete(t models.Todo) error
-	IsAllowed(userID int, todoID int) bool
+	Trash(userID int) ([]*models.Todo, error)
+	FindTrashedByID(todoID int) (models.Todo, error)
+	Restore(t models.Todo) (models.Todo, error)
+	Purge(t models.Todo) error
+	PurgeTrashed(before time.Time) (int64, error)
+	Bulk(userID int, input models.TodoBulkInput) ([]models.TodoBulkResult, error)
+	Move(todoID int, userID int, input models.MoveInput) (models.Todo, error)
+	MoveToList(todoID int, userID int, todoListID *int) (models.Todo, error)
+	Complete(t models.Todo, authorID int) (models.TodoCompleteResult, error)
+	Occurrences(t models.Todo, limit int) ([]models.TodoOccurrence, error)
+	Today(userID int, loc *time.Location, now time.Time) ([]*models.Todo, error)
+	Upcoming(userID int, loc *time.Location, weekStart time.Weekday, now time.Time, days int) ([]*models.Todo, error)
+	Overdue(userID int, loc *time.Location, now time.Time) ([]*models.Todo, error)
 }
 
+var (
+	ErrColorNotFound = errors.New("color not found")
+	ErrListNotFound  = errors.New("todo list not found")
+
+	ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+	ErrInvalidDue        = errors.New("invalid due date")
+)
+
 type todoService struct {
 	db *gorm.DB
 }
@@ -24,9 +50,15 @@ func NewTodoService(db *gorm.DB) TodoService {
 	return &todoService{db}
 }
 
-func (ts *todoService) All(userID int) ([]*models.Todo, error) {
+func (ts *todoService) All(userID int, filter models.TodoFilter) ([]*models.Todo, error) {
 	var todos []*models.Todo
-	err := ts.db.Preload("User").Preload("Color").Where("user_id = ?", userID).Find(&todos).Error
+	query := ts.db.Preload("User").Preload("Color").Preload("Reminders")
+	if filter.TodoListID != nil {
+		query = query.Where("todo_list_id = ?", *filter.TodoListID)
+	} else {
+		query = query.Where("user_id = ? OR todo_list_id IN (?)", userID, sharedTodoListIDs(ts.db, userID))
+	}
+	err := query.Order(positionOrder).Order("id").Find(&todos).Error
 	if err != nil {
 		return nil, err
 	}
@@ -35,7 +67,7 @@ func (ts *todoService) All(userID int) ([]*models.Todo, error) {
 
 func (ts *todoService) FindByID(todoID int, userID int) (models.Todo, error) {
 	var todo models.Todo
-	err := ts.db.Preload("User").Preload("Color").Find(&todo, todoID).Error
+	err := ts.db.Preload("User").Preload("Color").Preload("Reminders").Find(&todo, todoID).Error
 	if err != nil {
 		return models.Todo{}, err
 	}
@@ -48,12 +80,60 @@ func (ts *todoService) Insert(t models.TodoInput) (models.Todo, error) {
 	if err != nil {
 		return models.Todo{}, err
 	}
-	err = ts.db.Save(&todo).Error
+
+	if err := checkList(ts.db, t.UserID, t.TodoListID); err != nil {
+		return models.Todo{}, err
+	}
+
+	// A default color trashed since it was chosen is skipped
+	if todo.ColorID == nil && t.DefaultColorID != nil {
+		var color models.Color
+		if err := ts.db.Find(&color, *t.DefaultColorID).Error; err != nil {
+			return models.Todo{}, err
+		}
+		if color.ID == *t.DefaultColorID {
+			todo.ColorID = &color.ID
+		}
+	}
+
+	if err := resolveDue(&todo, t.Due, t.DueTimezone); err != nil {
+		return models.Todo{}, err
+	}
+
+	weekStart, err := userWeekStart(ts.db, t.UserID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	todo.Recurrence, err = normalizeRecurrence(t.Recurrence, weekStart)
 	if err != nil {
 		return models.Todo{}, err
 	}
+	startRecurrence(&todo)
+
+	err = ts.db.Transaction(func(tx *gorm.DB) error {
+		last, err := lastPosition(tx, &models.Todo{}, t.UserID)
+		if err != nil {
+			return err
+		}
+		todo.Position = utils.RankAfter(last)
 
-	err = ts.db.Preload("User").Preload("Color").Find(&todo).Error
+		if err := tx.Save(&todo).Error; err != nil {
+			return err
+		}
+		inputs := t.ReminderInputs
+		if inputs == nil && t.Reminder != nil {
+			inputs = legacyReminders(t.Reminder)
+		}
+		if err := setReminders(tx, todo, inputs); err != nil {
+			return err
+		}
+		return recordRevision(tx, todo.ID, &t.UserID)
+	})
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	err = ts.db.Preload("User").Preload("Color").Preload("Reminders").Find(&todo).Error
 	if err != nil {
 		return models.Todo{}, err
 	}
@@ -61,25 +141,69 @@ func (ts *todoService) Insert(t models.TodoInput) (models.Todo, error) {
 	return todo, nil
 }
 
-func (ts *todoService) Update(todoID int, t models.TodoInput) (models.Todo, error) {
+// Update changes a todo on behalf of the author, keeping the previous state as a
+// revision
+func (ts *todoService) Update(todoID int, authorID int, t models.TodoInput) (models.Todo, error) {
+	// The author, not the creator of the todo, must be allowed into the list
+	if err := checkList(ts.db, authorID, t.TodoListID); err != nil {
+		return models.Todo{}, err
+	}
+
 	var todo models.Todo
-	err := smapping.FillStruct(&todo, smapping.MapFields(&t))
+	err := ts.db.Find(&todo, todoID).Error
 	if err != nil {
 		return models.Todo{}, err
 	}
 
-	err = ts.db.Preload("User").Preload("Color").Find(&todo, todoID).Error
+	weekStart, err := userWeekStart(ts.db, authorID)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	recurrence, err := normalizeRecurrence(t.Recurrence, weekStart)
+	if err != nil {
+		return models.Todo{}, err
+	}
+	// A rule stored before it had a WKST is the same rule once it gets one
+	previousRecurrence, err := normalizeRecurrence(todo.Recurrence, weekStart)
+	if err != nil {
+		previousRecurrence = todo.Recurrence
+	}
+
+	err = smapping.FillStruct(&todo, smapping.MapFields(&t))
 	if err != nil {
 		return models.Todo{}, err
 	}
 
+	if err := resolveDue(&todo, t.Due, t.DueTimezone); err != nil {
+		return models.Todo{}, err
+	}
+
+	// A changed rule starts a new series from this todo
+	todo.Recurrence = recurrence
+	if recurrence != previousRecurrence {
+		startRecurrence(&todo)
+	}
+
 	todo.ID = todoID
-	err = ts.db.Save(&todo).Error
+	err = ts.db.Transaction(func(tx *gorm.DB) error {
+		return withRevision(tx, todoID, authorID, func() error {
+			if err := tx.Save(&todo).Error; err != nil {
+				return err
+			}
+			if t.ReminderInputs != nil {
+				return setReminders(tx, todo, t.ReminderInputs)
+			}
+			if t.Reminder != nil {
+				return setReminders(tx, todo, legacyReminders(t.Reminder))
+			}
+			return refreshReminders(tx, todo)
+		})
+	})
 	if err != nil {
 		return models.Todo{}, err
 	}
 
-	err = ts.db.Preload("User").Preload("Color").Find(&todo, todoID).Error
+	err = ts.db.Preload("User").Preload("Color").Preload("Reminders").Find(&todo, todoID).Error
 	if err != nil {
 		return models.Todo{}, err
 	}
@@ -94,8 +218,390 @@ func (ts *todoService) Delete(t models.Todo) error {
 	return nil
 }
 
-func (ts *todoService) IsAllowed(userID int, todoID int) bool {
+// Trash lists the trashed todos the user may restore: their own and those of the
+// lists they own or edit
+func (ts *todoService) Trash(userID int) ([]*models.Todo, error) {
+	var todos []*models.Todo
+	ownListIDs := ts.db.Model(&models.TodoList{}).Select("id").Where("user_id = ?", userID)
+	editedListIDs := sharedTodoListIDs(ts.db, userID).Where("role IN ?", []string{models.RoleEditor, models.RoleOwner})
+	err := ts.db.Unscoped().Preload("Color").
+		Where("user_id = ? OR todo_list_id IN (?) OR todo_list_id IN (?)", userID, ownListIDs, editedListIDs).
+		Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&todos).Error
+	if err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+func (ts *todoService) FindTrashedByID(todoID int) (models.Todo, error) {
+	var todo models.Todo
+	err := ts.db.Unscoped().Preload("Color").Where("deleted_at IS NOT NULL").Find(&todo, todoID).Error
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return todo, nil
+}
+
+func (ts *todoService) Restore(t models.Todo) (models.Todo, error) {
+	err := ts.db.Unscoped().Model(&models.Todo{}).Where("id = ?", t.ID).Update("deleted_at", nil).Error
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	var todo models.Todo
+	err = ts.db.Preload("User").Preload("Color").Preload("Reminders").Find(&todo, t.ID).Error
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return todo, nil
+}
+
+func (ts *todoService) Purge(t models.Todo) error {
+	err := ts.db.Unscoped().Delete(&models.Todo{}, t.ID).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// PurgeTrashed hard-deletes every todo that was trashed before the given time
+func (ts *todoService) PurgeTrashed(before time.Time) (int64, error) {
+	result := ts.db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&models.Todo{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// Bulk applies one operation to many todos inside a single transaction. Items the
+// user may not edit or that don't exist are reported per item and left untouched.
+func (ts *todoService) Bulk(userID int, input models.TodoBulkInput) ([]models.TodoBulkResult, error) {
+	results := make([]models.TodoBulkResult, 0, len(input.IDs))
+
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		if input.Operation == "setColor" && input.ColorID != nil {
+			var color models.Color
+			if err := tx.Find(&color, *input.ColorID).Error; err != nil {
+				return err
+			}
+			if color.ID != *input.ColorID {
+				return ErrColorNotFound
+			}
+		}
+
+		if input.Operation == "moveToList" {
+			if err := checkList(tx, userID, input.TodoListID); err != nil {
+				return err
+			}
+		}
+
+		var todos []models.Todo
+		if err := tx.Unscoped().Preload("User").Preload("Color").Preload("Reminders").Where("id IN ?", input.IDs).Find(&todos).Error; err != nil {
+			return err
+		}
+		found := make(map[int]models.Todo, len(todos))
+		for _, todo := range todos {
+			found[todo.ID] = todo
+		}
+
+		now := time.Now()
+		for _, id := range input.IDs {
+			todo, ok := found[id]
+			if !ok {
+				results = append(results, models.TodoBulkResult{ID: id, Error: "No data with given id"})
+				continue
+			}
+			role, err := todoRole(tx, userID, todo)
+			if err != nil {
+				return err
+			}
+			if !models.RoleAtLeast(role, models.RoleEditor) {
+				results = append(results, models.TodoBulkResult{ID: id, Error: "You dont have permission"})
+				continue
+			}
+
+			query := tx.Unscoped().Model(&models.Todo{}).Where("id = ?", id)
+			err = withRevision(tx, id, userID, func() error {
+				switch input.Operation {
+				case "delete":
+					return tx.Delete(&models.Todo{}, id).Error
+				case "restore":
+					return query.Update("deleted_at", nil).Error
+				case "setColor":
+					return query.Update("color_id", input.ColorID).Error
+				case "setReminder":
+					if err := query.Update("reminder", input.Reminder).Error; err != nil {
+						return err
+					}
+					return setReminders(tx, todo, legacyReminders(input.Reminder))
+				case "complete":
+					next, err := completeTodo(tx, todo, now)
+					if err != nil || next == nil {
+						return err
+					}
+					return recordRevision(tx, next.ID, &userID)
+				case "moveToList":
+					return query.Update("todo_list_id", input.TodoListID).Error
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			result := models.TodoBulkResult{ID: id, Success: true, Before: &todo}
+			if input.Operation != "delete" {
+				var after models.Todo
+				if err := tx.Unscoped().Preload("User").Preload("Color").Preload("Reminders").Find(&after, id).Error; err != nil {
+					return err
+				}
+				result.After = &after
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Move places a todo directly before or after another todo of the same user
+func (ts *todoService) Move(todoID int, userID int, input models.MoveInput) (models.Todo, error) {
+	err := movePosition(ts.db, &models.Todo{}, todoID, userID, input)
+	if err != nil {
+		return models.Todo{}, err
+	}
+
+	var todo models.Todo
+	err = ts.db.Preload("User").Preload("Color").Preload("Reminders").Find(&todo, todoID).Error
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return todo, nil
+}
+
+// MoveToList moves a todo into another list of the same user, or out of any list
+// when todoListID is nil
+func (ts *todoService) MoveToList(todoID int, userID int, todoListID *int) (models.Todo, error) {
+	if err := checkList(ts.db, userID, todoListID); err != nil {
+		return models.Todo{}, err
+	}
+
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		return withRevision(tx, todoID, userID, func() error {
+			return tx.Model(&models.Todo{}).Where("id = ?", todoID).Update("todo_list_id", todoListID).Error
+		})
+	})
+	if err != nil {
+		return models.Todo{}, err
+	}
+
 	var todo models.Todo
-	ts.db.Debug().Find(&todo, todoID)
-	return userID == todo.UserID
+	err = ts.db.Preload("User").Preload("Color").Preload("Reminders").Find(&todo, todoID).Error
+	if err != nil {
+		return models.Todo{}, err
+	}
+	return todo, nil
+}
+
+// checkList makes sure the user may put todos into the referenced todo list
+func checkList(tx *gorm.DB, userID int, todoListID *int) error {
+	if todoListID == nil {
+		return nil
+	}
+
+	role, err := todoListRole(tx, userID, *todoListID)
+	if err != nil {
+		return err
+	}
+	if !models.RoleAtLeast(role, models.RoleEditor) {
+		return ErrListNotFound
+	}
+	return nil
+}
+
+// Complete marks a todo as done. For a recurring todo this creates the todo of the
+// next occurrence, which is returned along with the completed one.
+func (ts *todoService) Complete(t models.Todo, authorID int) (models.TodoCompleteResult, error) {
+	var result models.TodoCompleteResult
+	err := ts.db.Transaction(func(tx *gorm.DB) error {
+		var next *models.Todo
+		err := withRevision(tx, t.ID, authorID, func() (err error) {
+			next, err = completeTodo(tx, t, time.Now())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Preload("User").Preload("Color").Preload("Reminders").Find(&result.Todo, t.ID).Error; err != nil {
+			return err
+		}
+		if next != nil {
+			if err := recordRevision(tx, next.ID, &authorID); err != nil {
+				return err
+			}
+			result.Next = next
+			return tx.Preload("User").Preload("Color").Preload("Reminders").Find(result.Next, next.ID).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return models.TodoCompleteResult{}, err
+	}
+	return result, nil
+}
+
+// Occurrences previews the occurrences following the current one of a recurring todo
+func (ts *todoService) Occurrences(t models.Todo, limit int) ([]models.TodoOccurrence, error) {
+	occurrences := []models.TodoOccurrence{}
+	if t.Recurrence == "" || t.RecurrenceStart == nil || t.OccurrenceAt == nil {
+		return occurrences, nil
+	}
+
+	rule, err := utils.ParseRRule(t.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	times, indexes := rule.Between(t.RecurrenceStart.In(recurrenceLocation(t)), *t.OccurrenceAt, limit)
+	for i, at := range times {
+		occurrence := models.TodoOccurrence{Index: indexes[i], OccurrenceAt: at}
+		if t.Reminder != nil {
+			reminder := t.Reminder.Add(at.Sub(*t.OccurrenceAt))
+			occurrence.Reminder = &reminder
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	return occurrences, nil
+}
+
+// normalizeRecurrence validates an RRULE and returns it in canonical form. Weekly
+// rules without a WKST get the given week start.
+func normalizeRecurrence(recurrence string, weekStart time.Weekday) (string, error) {
+	if recurrence == "" {
+		return "", nil
+	}
+	rule, err := utils.ParseRRule(recurrence)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidRecurrence, err.Error())
+	}
+	if rule.Freq == "WEEKLY" && rule.WeekStart == nil {
+		rule.WeekStart = &weekStart
+	}
+	return rule.String(), nil
+}
+
+// userWeekStart is the day weeks start on in the preferences of a user
+func userWeekStart(db *gorm.DB, userID int) (time.Weekday, error) {
+	var user models.User
+	if err := db.Select("id", "pref_week_start").First(&user, userID).Error; err != nil {
+		return time.Monday, err
+	}
+	return user.Preferences.FirstWeekday(), nil
+}
+
+// startRecurrence makes the todo the first occurrence of its series, anchored at
+// its due date, its reminder or, without either, at the current minute
+func startRecurrence(todo *models.Todo) {
+	if todo.Recurrence == "" {
+		todo.RecurrenceStart, todo.OccurrenceAt, todo.OccurrenceIndex = nil, nil, 0
+		return
+	}
+
+	start := time.Now().UTC().Truncate(time.Minute)
+	if due := dueInstant(*todo); due != nil {
+		start = *due
+	} else if todo.Reminder != nil {
+		start = *todo.Reminder
+	}
+	todo.RecurrenceStart, todo.OccurrenceAt, todo.OccurrenceIndex = &start, &start, 1
+}
+
+// recurrenceLocation is the timezone a series is expanded in, so occurrences keep
+// their local time of day across daylight saving changes
+func recurrenceLocation(todo models.Todo) *time.Location {
+	loc, err := time.LoadLocation(todo.DueTimezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// completeTodo marks a todo as done and, when it recurs, creates the next occurrence
+// with its reminder shifted by the same offset as the occurrence itself
+func completeTodo(tx *gorm.DB, todo models.Todo, now time.Time) (*models.Todo, error) {
+	if todo.Completed {
+		return nil, nil
+	}
+
+	err := tx.Unscoped().Model(&models.Todo{}).Where("id = ?", todo.ID).Updates(map[string]interface{}{"completed": true, "completed_at": now}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if todo.Recurrence == "" || todo.RecurrenceStart == nil || todo.OccurrenceAt == nil {
+		return nil, nil
+	}
+
+	rule, err := utils.ParseRRule(todo.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	at, index, ok := rule.Next(todo.RecurrenceStart.In(recurrenceLocation(todo)), *todo.OccurrenceAt)
+	if !ok {
+		return nil, nil
+	}
+
+	next := models.Todo{
+		Title:           todo.Title,
+		Isi:             todo.Isi,
+		ColorID:         todo.ColorID,
+		UserID:          todo.UserID,
+		TodoListID:      todo.TodoListID,
+		Recurrence:      todo.Recurrence,
+		RecurrenceStart: todo.RecurrenceStart,
+		OccurrenceAt:    &at,
+		OccurrenceIndex: index,
+	}
+	offset := at.Sub(*todo.OccurrenceAt)
+	if todo.Reminder != nil {
+		reminder := todo.Reminder.Add(offset)
+		next.Reminder = &reminder
+	}
+	if todo.DueDate != nil {
+		due := todo.DueDate.Add(offset)
+		next.DueDate, next.DueAllDay, next.DueTimezone = &due, todo.DueAllDay, todo.DueTimezone
+	}
+
+	last, err := lastPosition(tx, &models.Todo{}, todo.UserID)
+	if err != nil {
+		return nil, err
+	}
+	next.Position = utils.RankAfter(last)
+
+	err = tx.Omit(clause.Associations).Create(&next).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Absolute reminders move along with the occurrence, offsets follow the new due date
+	var reminders []models.TodoReminder
+	if err := tx.Where("todo_id = ?", todo.ID).Find(&reminders).Error; err != nil {
+		return nil, err
+	}
+	inputs := make([]models.TodoReminderInput, len(reminders))
+	for i, reminder := range reminders {
+		inputs[i].OffsetMinutes = reminder.OffsetMinutes
+		if reminder.At != nil {
+			at := reminder.At.Add(offset)
+			inputs[i].At = &at
+		}
+	}
+	if err := setReminders(tx, next, inputs); err != nil {
+		return nil, err
+	}
+	return &next, nil
 }
@@ -1,19 +1,48 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"golang/models"
+	"golang/utils"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/mashingan/smapping"
+	"github.com/thanhpk/randstr"
 	"gorm.io/gorm"
 )
 
 type UserService interface {
 	FindUserById(string) (*models.User, error)
 	FindUserByEmail(string) (*models.User, error)
-	Update(userUpdate *models.UserEdit) (*models.User, error)
+	FindUserByAccessToken(token string) (*models.User, *models.AccessToken, error)
+	FindUserByOAuthGrant(grantID int) (*models.User, *models.OAuthGrant, error)
+	Update(userID int, userUpdate models.UserEdit) (*models.User, error)
+	ChangePassword(userID int, hashedPassword string) (time.Time, error)
+	UpdatePreferences(userID int, preferences models.UserPreferencesInput) (*models.User, error)
+	ScheduleDeletion(userID int, at time.Time) error
+	CancelDeletion(userID int) error
+	DeleteScheduled(now time.Time) (int, error)
+	RequestEmailChange(user *models.User, email string) (string, string, error)
+	ConfirmEmailChange(token string) (*models.User, error)
+	RevertEmailChange(token string) (*models.User, error)
 }
 
+var (
+	ErrInvalidPreferences  = errors.New("invalid preferences")
+	ErrEmailTaken          = errors.New("email already exist")
+	ErrEmailChangeNotFound = errors.New("email change not found or expired")
+)
+
+const (
+	// emailChangeExpiry is how long the new address has to confirm a change
+	emailChangeExpiry = 24 * time.Hour
+	// emailRevertPeriod is how long the old address can revert a change
+	emailRevertPeriod = 7 * 24 * time.Hour
+)
+
 type userService struct {
 	db *gorm.DB
 }
@@ -24,7 +53,7 @@ func NewUserService(db *gorm.DB) UserService {
 
 func (us *userService) FindUserById(id string) (*models.User, error) {
 	var user *models.User
-	err := us.db.Find(&user, id).Error
+	err := us.db.First(&user, id).Error
 	if err != nil {
 		return &models.User{}, err
 	}
@@ -42,17 +71,280 @@ func (us *userService) FindUserByEmail(email string) (*models.User, error) {
 	return user, nil
 }
 
-func (us *userService) Update(userUpdate *models.UserEdit) (*models.User, error) {
-	var user *models.User
-	err := smapping.FillStruct(&user, smapping.MapFields(&userUpdate))
+// FindUserByAccessToken authenticates a personal access token
+func (us *userService) FindUserByAccessToken(token string) (*models.User, *models.AccessToken, error) {
+	accessToken, err := findAccessToken(us.db, token)
+	if err != nil {
+		return &models.User{}, nil, err
+	}
+
+	user, err := us.FindUserById(strconv.Itoa(accessToken.UserID))
+	if err != nil {
+		return &models.User{}, nil, err
+	}
+	return user, accessToken, nil
+}
+
+// FindUserByOAuthGrant returns the user who gave a third-party app the grant an
+// OAuth access token was issued for
+func (us *userService) FindUserByOAuthGrant(grantID int) (*models.User, *models.OAuthGrant, error) {
+	grant, err := findOAuthGrant(us.db, grantID)
+	if err != nil {
+		return &models.User{}, nil, err
+	}
+
+	user, err := us.FindUserById(strconv.Itoa(grant.UserID))
+	if err != nil {
+		return &models.User{}, nil, err
+	}
+	return user, grant, nil
+}
+
+// Update changes the profile of a user, and the preferences when they're given
+func (us *userService) Update(userID int, userUpdate models.UserEdit) (*models.User, error) {
+	if userUpdate.Preferences != nil {
+		if _, err := us.UpdatePreferences(userID, *userUpdate.Preferences); err != nil {
+			return &models.User{}, err
+		}
+	}
+
+	err := us.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"name":   userUpdate.Name,
+		"avatar": userUpdate.Avatar,
+	}).Error
 	if err != nil {
 		return &models.User{}, err
 	}
 
-	err = us.db.Save(&user).Error
+	return us.FindUserById(strconv.Itoa(userID))
+}
+
+// ChangePassword stores a new password and revokes the sessions opened before,
+// returning the time from which sessions are valid again
+func (us *userService) ChangePassword(userID int, hashedPassword string) (time.Time, error) {
+	validAfter := time.Now().Truncate(time.Second)
+	err := us.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":             hashedPassword,
+		"password_reset_token": "",
+		"sessions_valid_after": validAfter,
+	}).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	return validAfter, nil
+}
+
+func (us *userService) UpdatePreferences(userID int, preferences models.UserPreferencesInput) (*models.User, error) {
+	if _, err := time.LoadLocation(preferences.Timezone); err != nil || preferences.Timezone == "" {
+		return &models.User{}, fmt.Errorf("%w: unknown timezone %q", ErrInvalidPreferences, preferences.Timezone)
+	}
+	if preferences.DefaultColorID != nil {
+		var color models.Color
+		if err := us.db.Find(&color, *preferences.DefaultColorID).Error; err != nil {
+			return &models.User{}, err
+		}
+		if color.ID != *preferences.DefaultColorID {
+			return &models.User{}, ErrColorNotFound
+		}
+	}
+
+	err := us.db.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"pref_timezone":          preferences.Timezone,
+		"pref_locale":            preferences.Locale,
+		"pref_week_start":        preferences.WeekStart,
+		"pref_default_color_id":  preferences.DefaultColorID,
+		"pref_email_reminders":   preferences.EmailReminders,
+		"pref_email_invitations": preferences.EmailInvitations,
+		"pref_email_mentions":    preferences.EmailMentions,
+	}).Error
 	if err != nil {
 		return &models.User{}, err
 	}
 
-	return user, nil
+	return us.FindUserById(strconv.Itoa(userID))
+}
+
+// ScheduleDeletion marks the account for deletion once the grace period ends
+func (us *userService) ScheduleDeletion(userID int, at time.Time) error {
+	return us.db.Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", at).Error
+}
+
+func (us *userService) CancelDeletion(userID int) error {
+	return us.db.Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", nil).Error
+}
+
+// DeleteScheduled deletes the accounts whose grace period is over
+func (us *userService) DeleteScheduled(now time.Time) (int, error) {
+	var users []models.User
+	err := us.db.Where("deletion_scheduled_at <= ?", now).Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		if err := us.deleteAccount(user, now); err != nil {
+			return 0, err
+		}
+	}
+	return len(users), nil
+}
+
+// deleteAccount removes a user and everything they own. Todos others created in
+// the user's lists stay with their creators, detached from the list. Colors are
+// shared between users and are kept. The audit log keeps its entries about the
+// user, anonymized.
+func (us *userService) deleteAccount(user models.User, now time.Time) error {
+	var exportPaths []string
+	err := us.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Export{}).Where("user_id = ? AND path <> ''", user.ID).Pluck("path", &exportPaths).Error; err != nil {
+			return err
+		}
+
+		todos := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.Todo{})
+		if todos.Error != nil {
+			return todos.Error
+		}
+
+		listIDs := tx.Model(&models.TodoList{}).Select("id").Where("user_id = ?", user.ID)
+		if err := tx.Model(&models.Todo{}).Unscoped().Where("todo_list_id IN (?)", listIDs).Update("todo_list_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? OR todo_list_id IN (?)", user.ID, listIDs).Delete(&models.TodoListShare{}).Error; err != nil {
+			return err
+		}
+		lists := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.TodoList{})
+		if lists.Error != nil {
+			return lists.Error
+		}
+
+		for _, model := range []interface{}{&models.TodoImport{}, &models.Export{}, &models.AccessToken{}, &models.UserIdentity{}, &models.OIDCLogin{}, &models.OAuthCode{}, &models.OAuthGrant{}, &models.OAuthClient{}, &models.MagicLink{}, &models.TodoComment{}} {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&models.User{}, user.ID).Error; err != nil {
+			return err
+		}
+		if err := anonymizeAuditLog(tx, user); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.AccountDeletion{
+			ScheduledFor: *user.DeletionScheduledAt,
+			DeletedAt:    now,
+			Todos:        todos.RowsAffected,
+			TodoLists:    lists.RowsAffected,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range exportPaths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RequestEmailChange starts changing the email of a user and returns the token
+// confirming the change and the one reverting it. Earlier pending changes are
+// dropped.
+func (us *userService) RequestEmailChange(user *models.User, email string) (string, string, error) {
+	email = strings.ToLower(email)
+
+	var taken int64
+	if err := us.db.Model(&models.User{}).Where("email = ?", email).Count(&taken).Error; err != nil {
+		return "", "", err
+	}
+	if taken > 0 {
+		return "", "", ErrEmailTaken
+	}
+
+	confirmToken, revertToken := randstr.String(32), randstr.String(32)
+	now := time.Now()
+	err := us.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND confirmed_at IS NULL AND reverted_at IS NULL", user.ID).Delete(&models.EmailChange{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.EmailChange{
+			OldEmail:        user.Email,
+			NewEmail:        email,
+			ConfirmToken:    utils.HashToken(confirmToken),
+			RevertToken:     utils.HashToken(revertToken),
+			ExpiresAt:       now.Add(emailChangeExpiry),
+			RevertExpiresAt: now.Add(emailRevertPeriod),
+			UserID:          user.ID,
+		}).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return confirmToken, revertToken, nil
+}
+
+// ConfirmEmailChange applies a change confirmed from the new address
+func (us *userService) ConfirmEmailChange(token string) (*models.User, error) {
+	var change models.EmailChange
+	err := us.db.Where("confirm_token = ? AND confirmed_at IS NULL AND reverted_at IS NULL AND expires_at > ?", utils.HashToken(token), time.Now()).
+		First(&change).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.User{}, ErrEmailChangeNotFound
+	}
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	err = us.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("id = ? AND email = ?", change.UserID, change.OldEmail).Update("email", change.NewEmail)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrEmailChangeNotFound
+		}
+		return tx.Model(&change).Update("confirmed_at", time.Now()).Error
+	})
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	return us.FindUserById(strconv.Itoa(change.UserID))
+}
+
+// RevertEmailChange cancels a change from the old address, restoring it if the
+// change was already confirmed. A pending password reset is dropped and every
+// session is logged out as well, in case the change came from someone who took
+// over the account.
+func (us *userService) RevertEmailChange(token string) (*models.User, error) {
+	var change models.EmailChange
+	err := us.db.Where("revert_token = ? AND reverted_at IS NULL AND revert_expires_at > ?", utils.HashToken(token), time.Now()).
+		First(&change).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.User{}, ErrEmailChangeNotFound
+	}
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	err = us.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{
+			"password_reset_token": "",
+			"sessions_valid_after": time.Now().Truncate(time.Second),
+		}
+		if change.ConfirmedAt != nil {
+			updates["email"] = change.OldEmail
+		}
+		if err := tx.Model(&models.User{}).Where("id = ?", change.UserID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Model(&change).Update("reverted_at", time.Now()).Error
+	})
+	if err != nil {
+		return &models.User{}, err
+	}
+
+	return us.FindUserById(strconv.Itoa(change.UserID))
 }
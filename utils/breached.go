@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"golang/config"
+)
+
+// bundledBreachedPasswords holds the SHA-1 hashes of common passwords seen in breaches,
+// so the plain passwords are neither shipped nor sent anywhere to be checked
+//
+//go:embed breached_passwords.txt
+var bundledBreachedPasswords string
+
+var (
+	breachedFilter     *BloomFilter
+	breachedFilterOnce sync.Once
+)
+
+// IsBreachedPassword tells whether a password is in the bundled list of breached
+// passwords, or in the list BREACHED_PASSWORDS_FILE points to. The list is kept as
+// a bloom filter, so a rare false positive rejects a password that wasn't breached.
+func IsBreachedPassword(password string) bool {
+	breachedFilterOnce.Do(loadBreachedPasswords)
+	sum := sha1.Sum([]byte(password))
+	return breachedFilter.Test(sum)
+}
+
+func loadBreachedPasswords() {
+	hashes := readPasswordHashes(strings.NewReader(bundledBreachedPasswords))
+
+	config, _ := config.LoadConfig()
+	if config.BreachedPasswordsFile != "" {
+		file, err := os.Open(config.BreachedPasswordsFile)
+		if err != nil {
+			log.Println("Could not open the breached passwords file", err)
+		} else {
+			hashes = append(hashes, readPasswordHashes(file)...)
+			file.Close()
+		}
+	}
+
+	breachedFilter = NewBloomFilter(len(hashes), 0.001)
+	for _, hash := range hashes {
+		breachedFilter.Add(hash)
+	}
+}
+
+// readPasswordHashes reads one hex SHA-1 hash per line, optionally followed by
+// ":count" as in the Have I Been Pwned downloads
+func readPasswordHashes(r io.Reader) [][sha1.Size]byte {
+	var hashes [][sha1.Size]byte
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		var hash [sha1.Size]byte
+		if n, err := hex.Decode(hash[:], []byte(line)); err == nil && n == sha1.Size {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// BloomFilter is a set of SHA-1 digests that may answer false positives but never
+// false negatives
+type BloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint64
+}
+
+// NewBloomFilter sizes a filter for n entries at the given false positive rate
+func NewBloomFilter(n int, falsePositiveRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	size := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint64(math.Max(1, math.Round(float64(size)/float64(n)*math.Ln2)))
+	return &BloomFilter{bits: make([]uint64, (size+63)/64), size: size, hashes: hashes}
+}
+
+func (f *BloomFilter) Add(digest [sha1.Size]byte) {
+	for _, bit := range f.positions(digest) {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *BloomFilter) Test(digest [sha1.Size]byte) bool {
+	for _, bit := range f.positions(digest) {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// positions derives the bits of a digest by double hashing its two halves
+func (f *BloomFilter) positions(digest [sha1.Size]byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16]) | 1
+	positions := make([]uint64, f.hashes)
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % f.size
+	}
+	return positions
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	const n = 10000
+	filter := NewBloomFilter(n, 0.001)
+	for i := 0; i < n; i++ {
+		filter.Add(sha1.Sum([]byte("added-" + strconv.Itoa(i))))
+	}
+
+	// No false negatives, ever
+	for i := 0; i < n; i++ {
+		if !filter.Test(sha1.Sum([]byte("added-" + strconv.Itoa(i)))) {
+			t.Fatalf("added-%d is missing", i)
+		}
+	}
+
+	// False positives stay around the rate the filter was sized for
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if filter.Test(sha1.Sum([]byte("other-" + strconv.Itoa(i)))) {
+			falsePositives++
+		}
+	}
+	if falsePositives > n/200 {
+		t.Errorf("%d false positives out of %d", falsePositives, n)
+	}
+}
+
+func TestIsBreachedPassword(t *testing.T) {
+	for _, password := range []string{"password", "123456"} {
+		if !IsBreachedPassword(password) {
+			t.Errorf("%q is not in the bundled list", password)
+		}
+	}
+	if IsBreachedPassword("Vq7!mZp2#Lx9wR") {
+		t.Error("a random password is breached")
+	}
+
+	// Every bundled hash is in the filter
+	for _, hash := range readPasswordHashes(strings.NewReader(bundledBreachedPasswords)) {
+		if !breachedFilter.Test(hash) {
+			t.Errorf("%x is missing", hash)
+		}
+	}
+}
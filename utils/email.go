@@ -3,20 +3,27 @@ package utils
 import (
 	"bytes"
 	"fmt"
-	"log"
+	"html/template"
+	"mime"
 	"net/smtp"
 	"os"
 	"path/filepath"
-	"text/template"
+	"strings"
 
 	"golang/config"
 	"golang/models"
 )
 
 type EmailData struct {
-	URL       string
-	FirstName string
-	Subject   string
+	URL         string
+	FirstName   string
+	Subject     string
+	InviterName string
+	ListName    string
+	TodoTitle   string
+	Comment     string
+	When        string
+	Email       string
 }
 
 // 👇 Email template parser
@@ -40,10 +47,12 @@ func ParseTemplateDir(dir string) (*template.Template, error) {
 	return template.ParseFiles(paths...)
 }
 
+// SendEmail renders a template for the user and sends it. Errors are returned
+// rather than logged, background jobs must not die of a failing mail server.
 func SendEmail(user *models.User, data *EmailData, templateName string) error {
 	config, err := config.LoadConfig()
 	if err != nil {
-		log.Fatal("could not load config", err)
+		return fmt.Errorf("could not load config: %w", err)
 	}
 
 	// Sender data.
@@ -52,22 +61,33 @@ func SendEmail(user *models.User, data *EmailData, templateName string) error {
 
 	var body bytes.Buffer
 
-	template, err := ParseTemplateDir("templates")
+	// Every page defines its own "content" block, so only the requested page is
+	// parsed next to the shared layout
+	template, err := template.ParseFiles("templates/base.html", "templates/styles.html", filepath.Join("templates", templateName))
 	if err != nil {
-		log.Fatal("Could not parse template", err)
+		return fmt.Errorf("could not parse template: %w", err)
 	}
 
 	mimeHeaders := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
-	body.Write([]byte(fmt.Sprintf("Subject: %s \n%s\n\n", data.Subject, mimeHeaders)))
-	template.ExecuteTemplate(&body, "verificationCode.html", &data)
+	body.Write([]byte(fmt.Sprintf("Subject: %s \n%s\n\n", emailSubject(data.Subject), mimeHeaders)))
+	if err := template.ExecuteTemplate(&body, templateName, &data); err != nil {
+		return fmt.Errorf("could not render template: %w", err)
+	}
 
 	auth := smtp.PlainAuth("", config.SMTPUser, config.SMTPPass, config.SMTPHost)
 	addr := config.SMTPHost + ":" + config.Port
 	err = smtp.SendMail(addr, auth, from, to, body.Bytes())
 	if err != nil {
-		log.Fatal("Could not send email: ", err)
-		return err
+		return fmt.Errorf("could not send email: %w", err)
 	}
 
 	return nil
 }
+
+// emailSubject makes a subject safe for its header. Subjects carry names other
+// users chose, so line breaks that would start new headers are dropped and
+// anything but plain ASCII is encoded.
+func emailSubject(subject string) string {
+	subject = strings.Join(strings.FieldsFunc(subject, func(r rune) bool { return r == '\r' || r == '\n' }), " ")
+	return mime.QEncoding.Encode("UTF-8", subject)
+}
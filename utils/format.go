@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"strings"
+	"time"
+
+	"golang/models"
+)
+
+// timeLayouts maps a locale language to the layout times are written with in emails
+var timeLayouts = map[string]string{
+	"en": "Mon, Jan 2 2006 3:04 PM MST",
+	"id": "02/01/2006 15:04 MST",
+	"de": "02.01.2006 15:04 MST",
+	"fr": "02/01/2006 15:04 MST",
+	"nl": "02-01-2006 15:04 MST",
+	"ja": "2006/01/02 15:04 MST",
+}
+
+// FormatTime writes a time in the timezone and locale the user prefers
+func FormatTime(t time.Time, preferences models.UserPreferences) string {
+	language := strings.ToLower(strings.SplitN(strings.ReplaceAll(preferences.Locale, "_", "-"), "-", 2)[0])
+	layout, ok := timeLayouts[language]
+	if !ok {
+		layout = "2006-01-02 15:04 MST"
+	}
+	return t.In(preferences.Location()).Format(layout)
+}
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICalWriter builds an RFC 5545 document, escaping text values and folding long
+// content lines
+type ICalWriter struct {
+	b strings.Builder
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// Line writes a property whose value is already in iCalendar form
+func (w *ICalWriter) Line(name string, value string) {
+	line := name + ":" + value
+	for len(line) > 75 {
+		// Fold at 75 octets without splitting a UTF-8 sequence
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	w.b.WriteString(line + "\r\n")
+}
+
+// Text writes a property holding free text
+func (w *ICalWriter) Text(name string, value string) {
+	w.Line(name, icalEscaper.Replace(value))
+}
+
+// TextList writes a property holding a comma separated list of free texts
+func (w *ICalWriter) TextList(name string, values []string) {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = icalEscaper.Replace(value)
+	}
+	w.Line(name, strings.Join(escaped, ","))
+}
+
+// Time writes a property holding a UTC date-time
+func (w *ICalWriter) Time(name string, t time.Time) {
+	w.Line(name, ICalTime(t))
+}
+
+// Date writes a property holding a date without time
+func (w *ICalWriter) Date(name string, t time.Time) {
+	w.Line(name+";VALUE=DATE", t.Format("20060102"))
+}
+
+func (w *ICalWriter) String() string {
+	return w.b.String()
+}
+
+func ICalTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// ICalDuration formats a signed duration as an iCalendar DURATION value
+func ICalDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	minutes := int(d / time.Minute)
+	switch {
+	case minutes == 0:
+		return "PT0S"
+	case minutes%(24*60) == 0:
+		return sign + "P" + strconv.Itoa(minutes/(24*60)) + "D"
+	case minutes%60 == 0:
+		return sign + "PT" + strconv.Itoa(minutes/60) + "H"
+	default:
+		return sign + "PT" + strconv.Itoa(minutes) + "M"
+	}
+}
+
+// ParseICalDuration reads an iCalendar DURATION value such as -PT15M or P1DT2H
+func ParseICalDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("ical: invalid duration %q", value)
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	number := ""
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			number += string(c)
+			continue
+		case c == 'T' && !inTime && number == "":
+			inTime = true
+			continue
+		}
+
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("ical: invalid duration %q", value)
+		}
+		number = ""
+		switch {
+		case c == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case c == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case c == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case c == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case c == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, fmt.Errorf("ical: invalid duration %q", value)
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("ical: invalid duration %q", value)
+	}
+	return sign * d, nil
+}
+
+// ICalComponent is a parsed BEGIN/END block of an iCalendar document
+type ICalComponent struct {
+	Name       string
+	Properties []ICalProperty
+	Components []*ICalComponent
+}
+
+type ICalProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Get returns the first property with the given name
+func (c *ICalComponent) Get(name string) (ICalProperty, bool) {
+	for _, property := range c.Properties {
+		if property.Name == name {
+			return property, true
+		}
+	}
+	return ICalProperty{}, false
+}
+
+// Text returns the unescaped value of a text property
+func (p ICalProperty) Text() string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range p.Value {
+		if escaped {
+			if c == 'n' || c == 'N' {
+				c = '\n'
+			}
+			b.WriteRune(c)
+			escaped = false
+			continue
+		}
+		if c == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// ParseICal reads the components of an iCalendar document, unfolding its lines.
+// Properties outside of any component are ignored.
+func ParseICal(content string) ([]*ICalComponent, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var roots []*ICalComponent
+	var stack []*ICalComponent
+	for i, line := range lines {
+		property, err := parseICalLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("ical: line %d: %w", i+1, err)
+		}
+
+		switch property.Name {
+		case "BEGIN":
+			component := &ICalComponent{Name: strings.ToUpper(property.Value)}
+			if len(stack) == 0 {
+				roots = append(roots, component)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, component)
+			}
+			stack = append(stack, component)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(property.Value) {
+				return nil, fmt.Errorf("ical: line %d: unexpected END:%s", i+1, property.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) > 0 {
+				component := stack[len(stack)-1]
+				component.Properties = append(component.Properties, property)
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("ical: missing END:%s", stack[len(stack)-1].Name)
+	}
+	return roots, nil
+}
+
+func parseICalLine(line string) (ICalProperty, error) {
+	// The value starts at the first colon outside of a quoted parameter
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon <= 0 {
+		return ICalProperty{}, fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	property := ICalProperty{Name: strings.ToUpper(parts[0]), Params: map[string]string{}, Value: line[colon+1:]}
+	for _, param := range parts[1:] {
+		pair := strings.SplitN(param, "=", 2)
+		if len(pair) == 2 {
+			property.Params[strings.ToUpper(pair[0])] = strings.Trim(pair[1], `"`)
+		}
+	}
+	return property, nil
+}
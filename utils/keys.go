@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// KeySet holds the parsed keys tokens of one kind are signed with. The active
+// key signs new tokens, and every key of the set verifies them so tokens signed
+// before a rotation stay valid.
+type KeySet struct {
+	mutex  sync.RWMutex
+	active string
+	keys   map[string]*rsa.PrivateKey
+}
+
+var (
+	AccessTokenKeys  = &KeySet{}
+	RefreshTokenKeys = &KeySet{}
+)
+
+var ErrNoSigningKey = errors.New("no signing key loaded")
+
+// SetKeys replaces the keys of the set, by key id
+func (s *KeySet) SetKeys(active string, keys map[string]*rsa.PrivateKey) error {
+	if _, ok := keys[active]; !ok {
+		return fmt.Errorf("active key %q is not in the set", active)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.active = active
+	s.keys = keys
+	return nil
+}
+
+// sign signs the claims with the active key, naming it in the kid header
+func (s *KeySet) sign(claims jwt.MapClaims) (string, error) {
+	s.mutex.RLock()
+	key, ok := s.keys[s.active]
+	kid := s.active
+	s.mutex.RUnlock()
+	if !ok {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
+}
+
+// verificationKeys returns the keys that may have signed a token. Tokens issued
+// before keys had ids may come from any of them.
+func (s *KeySet) verificationKeys(kid string) []*rsa.PublicKey {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if kid != "" {
+		if key, ok := s.keys[kid]; ok {
+			return []*rsa.PublicKey{&key.PublicKey}
+		}
+		return nil
+	}
+
+	keys := make([]*rsa.PublicKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, &key.PublicKey)
+	}
+	return keys
+}
+
+// JWKS lists the public keys of the set, for other services to verify tokens
+func (s *KeySet) JWKS() []JSONWebKey {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := make([]JSONWebKey, 0, len(s.keys))
+	for kid, key := range s.keys {
+		keys = append(keys, JSONWebKey{
+			Kty: "RSA",
+			Kid: kid,
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return keys
+}
+
+// ParseSigningKey reads a PEM encoded RSA private key and derives its key id
+func ParseSigningKey(privateKey string) (*rsa.PrivateKey, string, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
+	if err != nil {
+		return nil, "", fmt.Errorf("parse key: %w", err)
+	}
+	return key, KeyThumbprint(&key.PublicKey), nil
+}
+
+// GenerateSigningKey creates a PEM encoded RSA private key
+func GenerateSigningKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	block := pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return string(pem.EncodeToMemory(&block)), nil
+}
+
+// KeyThumbprint is the RFC 7638 thumbprint of a public key, used as its key id
+// so every instance derives the same id for the same key
+func KeyThumbprint(key *rsa.PublicKey) string {
+	// The members are in lexicographic order as the RFC requires
+	data, _ := json.Marshal(struct {
+		E   string `json:"e"`
+		Kty string `json:"kty"`
+		N   string `json:"n"`
+	}{
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+	})
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
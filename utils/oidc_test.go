@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// mockOIDCProvider is an OpenID Connect provider serving discovery, its keys
+// and a token endpoint that checks PKCE
+type mockOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mutex sync.Mutex
+	// codes maps the authorization codes given out to their PKCE challenge
+	// and the claims of the id token they redeem for
+	codes map[string]mockOIDCCode
+	// basicAuth is the client id and secret of the last token request
+	basicAuth [2]string
+}
+
+type mockOIDCCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockOIDCProvider{key: key, codes: map[string]mockOIDCCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []JSONWebKey{{
+			Kty: "RSA",
+			Kid: "k1",
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		r.ParseForm()
+		user, pass, _ := r.BasicAuth()
+		p.basicAuth = [2]string{user, pass}
+		code, ok := p.codes[r.Form.Get("code")]
+		delete(p.codes, r.Form.Get("code"))
+		if r.Form.Get("grant_type") != "authorization_code" || !ok || PKCEChallenge(r.Form.Get("code_verifier")) != code.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, p.key, "k1", code.claims)})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// authorize gives out a code for the login an authorization URL starts
+func (p *mockOIDCProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) string {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL without PKCE: %s", authURL)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	code := "code-" + query.Get("state")
+	p.codes[code] = mockOIDCCode{challenge: query.Get("code_challenge"), claims: claims}
+	return code
+}
+
+func (p *mockOIDCProvider) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            "client",
+		"sub":            "subject-1",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"name":           "Alice",
+	}
+}
+
+func (p *mockOIDCProvider) sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestDiscoverOIDC(t *testing.T) {
+	p := newMockOIDCProvider(t)
+
+	provider, err := DiscoverOIDC(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.TokenEndpoint != p.URL+"/token" || provider.JWKSURI != p.URL+"/jwks" {
+		t.Errorf("unexpected endpoints: %+v", provider)
+	}
+
+	for name, document := range map[string]map[string]string{
+		"issuer mismatch": {"issuer": "https://evil.example.com", "authorization_endpoint": "a", "token_endpoint": "t", "jwks_uri": "j"},
+		"incomplete":      {"issuer": ""},
+	} {
+		document := document
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if document["issuer"] == "" {
+				document["issuer"] = "http://" + r.Host
+			}
+			json.NewEncoder(w).Encode(document)
+		}))
+		if _, err := DiscoverOIDC(server.URL); err == nil {
+			t.Errorf("%s: discovery succeeded", name)
+		}
+		server.Close()
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider, err := DiscoverOIDC(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, nonce := "verifier-of-at-least-forty-three-characters-long", "nonce-1"
+	authURL := provider.AuthCodeURL("client", "https://app.example.com/callback", []string{"openid", "email"}, "state-1", nonce, verifier)
+	query, _ := url.ParseQuery(authURL[len(p.URL+"/authorize?"):])
+	if query.Get("nonce") != nonce || query.Get("client_id") != "client" || query.Get("scope") != "openid email" {
+		t.Errorf("unexpected authorization URL: %s", authURL)
+	}
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		code := p.authorize(t, authURL, p.claims(nonce))
+		if _, err := provider.Exchange("client", "", "https://app.example.com/callback", code, "another-verifier"); err == nil {
+			t.Error("exchange succeeded with the wrong verifier")
+		}
+	})
+
+	t.Run("public client", func(t *testing.T) {
+		code := p.authorize(t, authURL, p.claims(nonce))
+		idToken, err := provider.Exchange("client", "", "https://app.example.com/callback", code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.basicAuth != [2]string{"", ""} {
+			t.Errorf("public client sent credentials: %v", p.basicAuth)
+		}
+		claims, err := provider.VerifyIDToken(idToken, "client", nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims.Subject != "subject-1" || claims.Email != "alice@example.com" || !claims.EmailVerified || claims.Name != "Alice" {
+			t.Errorf("unexpected claims: %+v", claims)
+		}
+	})
+
+	t.Run("confidential client", func(t *testing.T) {
+		code := p.authorize(t, authURL, p.claims(nonce))
+		if _, err := provider.Exchange("client", "s3cret", "https://app.example.com/callback", code, verifier); err != nil {
+			t.Fatal(err)
+		}
+		if p.basicAuth != [2]string{"client", "s3cret"} {
+			t.Errorf("unexpected client credentials: %v", p.basicAuth)
+		}
+	})
+
+	t.Run("code used twice", func(t *testing.T) {
+		code := p.authorize(t, authURL, p.claims(nonce))
+		provider.Exchange("client", "", "https://app.example.com/callback", code, verifier)
+		if _, err := provider.Exchange("client", "", "https://app.example.com/callback", code, verifier); err == nil {
+			t.Error("code redeemed twice")
+		}
+	})
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider, err := DiscoverOIDC(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(claims jwt.MapClaims)
+		key    *rsa.PrivateKey
+		kid    string
+		valid  bool
+	}{
+		{name: "valid", change: func(jwt.MapClaims) {}, valid: true},
+		{name: "audience list", change: func(c jwt.MapClaims) { c["aud"] = []string{"other", "client"} }, valid: true},
+		{name: "issuer with trailing slash", change: func(c jwt.MapClaims) { c["iss"] = p.URL + "/" }, valid: true},
+		{name: "wrong issuer", change: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "wrong audience", change: func(c jwt.MapClaims) { c["aud"] = "other" }},
+		{name: "wrong nonce", change: func(c jwt.MapClaims) { c["nonce"] = "replayed" }},
+		{name: "no nonce", change: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "expired", change: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "no expiry", change: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no subject", change: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "other key", change: func(jwt.MapClaims) {}, key: otherKey},
+		{name: "unknown key id", change: func(jwt.MapClaims) {}, key: otherKey, kid: "k2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := p.claims("nonce-1")
+			test.change(claims)
+			key, kid := p.key, "k1"
+			if test.key != nil {
+				key = test.key
+			}
+			if test.kid != "" {
+				kid = test.kid
+			}
+
+			_, err := provider.VerifyIDToken(p.sign(t, key, kid, claims), "client", "nonce-1")
+			if test.valid && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("accepted or unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenEmailVerified(t *testing.T) {
+	p := newMockOIDCProvider(t)
+	provider, err := DiscoverOIDC(p.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		value    interface{}
+		verified bool
+	}{
+		{true, true},
+		{"true", true},
+		{false, false},
+		{"false", false},
+		{nil, false},
+	} {
+		claims := p.claims("nonce-1")
+		if test.value == nil {
+			delete(claims, "email_verified")
+		} else {
+			claims["email_verified"] = test.value
+		}
+
+		result, err := provider.VerifyIDToken(p.sign(t, p.key, "k1", claims), "client", "nonce-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.EmailVerified != test.verified {
+			t.Errorf("email_verified %v: got %v", test.value, result.EmailVerified)
+		}
+	}
+}
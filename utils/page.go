@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"html/template"
+	"io"
+	"path/filepath"
+)
+
+// RenderPage renders a page of the templates directory with the shared layout.
+// Like emails, pages are rendered with html/template as they show data coming
+// from the request.
+func RenderPage(w io.Writer, templateName string, data interface{}) error {
+	page, err := template.ParseFiles("templates/base.html", "templates/styles.html", filepath.Join("templates", templateName))
+	if err != nil {
+		return err
+	}
+	return page.ExecuteTemplate(w, templateName, data)
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang/config"
+)
+
+// Codes of the rules a password can break
+const (
+	PasswordTooShort      = "too_short"
+	PasswordTooLong       = "too_long"
+	PasswordTooFewClasses = "too_few_classes"
+	PasswordHasUserInput  = "contains_user_input"
+	PasswordTooGuessable  = "too_guessable"
+	PasswordBreached      = "breached"
+)
+
+var ErrWeakPassword = errors.New("password is too weak")
+
+// PasswordPolicy are the rules passwords must follow. MinClasses counts the kinds
+// of characters used among lowercase, uppercase, digits and symbols, MinScore is
+// the lowest acceptable EstimatePasswordStrength score.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	MinClasses    int
+	MinScore      int
+	CheckBreached bool
+}
+
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password breaks
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e *PasswordPolicyError) Is(target error) bool {
+	return target == ErrWeakPassword
+}
+
+// ConfiguredPasswordPolicy is the policy set through the environment
+func ConfiguredPasswordPolicy() PasswordPolicy {
+	config, _ := config.LoadConfig()
+	return PasswordPolicy{
+		MinLength:     config.PasswordMinLength,
+		MaxLength:     config.PasswordMaxLength,
+		MinClasses:    config.PasswordMinClasses,
+		MinScore:      config.PasswordMinScore,
+		CheckBreached: config.PasswordCheckBreached,
+	}
+}
+
+// CheckPassword applies the configured policy. User inputs such as the name and
+// email may not appear in the password and make it easier to guess.
+func CheckPassword(password string, userInputs ...string) error {
+	return ConfiguredPasswordPolicy().Check(password, userInputs...)
+}
+
+// Check returns a *PasswordPolicyError listing the broken rules, or nil
+func (p PasswordPolicy) Check(password string, userInputs ...string) error {
+	var violations []PasswordViolation
+	violate := func(code string, format string, args ...interface{}) {
+		violations = append(violations, PasswordViolation{code, fmt.Sprintf(format, args...)})
+	}
+
+	if length := len([]rune(password)); length < p.MinLength {
+		violate(PasswordTooShort, "password must be at least %d characters long", p.MinLength)
+	}
+	// bcrypt ignores what comes after 72 bytes
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violate(PasswordTooLong, "password must be at most %d bytes long", p.MaxLength)
+	}
+
+	if classes := characterClasses(password); classes < p.MinClasses {
+		violate(PasswordTooFewClasses, "password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)
+	}
+
+	lowered := strings.ToLower(password)
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if len([]rune(input)) >= 3 && strings.Contains(lowered, input) {
+			violate(PasswordHasUserInput, "password must not contain your name or email")
+			break
+		}
+	}
+
+	if strength := EstimatePasswordStrength(password, userInputs...); strength.Score < p.MinScore {
+		violate(PasswordTooGuessable, "password is too easy to guess, add more words or characters")
+	}
+
+	if p.CheckBreached && IsBreachedPassword(password) {
+		violate(PasswordBreached, "password appears in known data breaches")
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{violations}
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	// Each case enables the rules it is about on top of this policy, which
+	// accepts anything but an empty password
+	lenient := PasswordPolicy{MinLength: 1}
+	strict := PasswordPolicy{MinLength: 12, MaxLength: 72, MinClasses: 3, MinScore: 3, CheckBreached: true}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		inputs   []string
+		codes    []string
+	}{
+		{name: "strong", policy: strict, password: "Vq7!mZp2#Lx9wR", inputs: []string{"Alice", "alice@example.com"}},
+		{name: "too short", policy: PasswordPolicy{MinLength: 12}, password: "Vq7!mZp2", codes: []string{PasswordTooShort}},
+		{name: "length counts characters", policy: PasswordPolicy{MinLength: 4}, password: "éàüö"},
+		{name: "72 bytes", policy: PasswordPolicy{MaxLength: 72}, password: strings.Repeat("a", 72)},
+		{name: "73 bytes", policy: PasswordPolicy{MaxLength: 72}, password: strings.Repeat("a", 73), codes: []string{PasswordTooLong}},
+		{name: "multibyte over 72 bytes", policy: PasswordPolicy{MinLength: 12, MaxLength: 72}, password: strings.Repeat("€", 25), codes: []string{PasswordTooLong}},
+		{name: "too few classes", policy: PasswordPolicy{MinClasses: 2}, password: "onlylowercase", codes: []string{PasswordTooFewClasses}},
+		{name: "enough classes", policy: PasswordPolicy{MinClasses: 4}, password: "aB3$"},
+		{name: "contains the name", policy: lenient, password: "xxALICExx", inputs: []string{"Alice"}, codes: []string{PasswordHasUserInput}},
+		{name: "contains the email", policy: lenient, password: "1alice@example.com!", inputs: []string{"Bob", " Alice@Example.com "}, codes: []string{PasswordHasUserInput}},
+		{name: "short inputs are ignored", policy: lenient, password: "xxalxx", inputs: []string{"al", ""}},
+		{name: "too guessable", policy: PasswordPolicy{MinScore: 3}, password: "password1", codes: []string{PasswordTooGuessable}},
+		{name: "breached password", policy: PasswordPolicy{CheckBreached: true}, password: "password", codes: []string{PasswordBreached}},
+		{name: "breached 123456", policy: PasswordPolicy{CheckBreached: true}, password: "123456", codes: []string{PasswordBreached}},
+		{name: "breach check disabled", policy: lenient, password: "123456"},
+		{
+			name:     "every rule",
+			policy:   strict,
+			password: "password",
+			inputs:   []string{"password"},
+			codes:    []string{PasswordTooShort, PasswordTooFewClasses, PasswordHasUserInput, PasswordTooGuessable, PasswordBreached},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.Check(test.password, test.inputs...)
+			if len(test.codes) == 0 {
+				if err != nil {
+					t.Fatalf("rejected: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrWeakPassword) {
+				t.Fatalf("got %v, want ErrWeakPassword", err)
+			}
+			var policyErr *PasswordPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("got %T", err)
+			}
+			codes := make([]string, len(policyErr.Violations))
+			for i, violation := range policyErr.Violations {
+				codes[i] = violation.Code
+				if violation.Message == "" {
+					t.Errorf("%s has no message", violation.Code)
+				}
+			}
+			if !reflect.DeepEqual(codes, test.codes) {
+				t.Errorf("got %v, want %v", codes, test.codes)
+			}
+		})
+	}
+}
+
+func TestEstimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		inputs   []string
+		maxScore int
+		minScore int
+	}{
+		{password: "password", maxScore: 0},
+		{password: "qwertyuiop", maxScore: 1},
+		{password: "P@ssw0rd", maxScore: 1},
+		{password: "abcdefgh", maxScore: 1},
+		{password: "1990", maxScore: 0},
+		{password: "aaaaaaaaaaaa", maxScore: 1},
+		{password: "alice1990", inputs: []string{"alice"}, maxScore: 1},
+		{password: "Vq7!mZp2#Lx9wR", minScore: 4, maxScore: 4},
+		{password: "correct horse battery staple", minScore: 3, maxScore: 4},
+	}
+	for _, test := range tests {
+		strength := EstimatePasswordStrength(test.password, test.inputs...)
+		if strength.Score < test.minScore || strength.Score > test.maxScore {
+			t.Errorf("%q scored %d (%g guesses), want %d to %d", test.password, strength.Score, strength.Guesses, test.minScore, test.maxScore)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// PasswordStrength estimates how many guesses an attacker needs to find a
+// password, in the spirit of zxcvbn: the password is split into the cheapest
+// sequence of dictionary words, keyboard runs, sequences, repeats, years and
+// brute-forced characters. Score goes from 0, too guessable, to 4, very unguessable.
+type PasswordStrength struct {
+	Guesses float64 `json:"guesses"`
+	Score   int     `json:"score"`
+}
+
+// passwordWords are common passwords and the words they're built from, the most
+// common first
+var passwordWords = strings.Fields(`
+	password qwerty dragon monkey letmein football baseball master shadow superman
+	welcome hello sunshine princess iloveyou love admin login trustno1 batman
+	starwars freedom whatever secret summer winter spring autumn michael jordan
+	jennifer hunter soccer hockey killer ranger charlie thomas robert daniel
+	andrew joshua matthew jessica ashley amanda nicole michelle george taylor
+	computer internet google apple samsung iphone facebook pokemon minecraft
+	naruto liverpool arsenal chelsea barcelona madrid manchester spiderman
+	pikachu snoopy mickey angel blessed jesus family friends forever flower
+	butterfly chocolate cookie orange banana purple yellow silver golden diamond
+	tiger lion eagle wolf dog cat bear horse mustang ferrari porsche harley
+	thunder matrix access pepper ginger maggie cheese test guest user demo
+	default changeme pass passw0rd root toor qwertyuiop asdf zxcvbn money
+	happy lucky magic music dance party game player gamer
+	baby babygirl girl boy king queen star rock blue red green black white
+	secure security welcome private office company school student
+`)
+
+var passwordRanks = func() map[string]int {
+	ranks := make(map[string]int, len(passwordWords))
+	for i, word := range passwordWords {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+	return ranks
+}()
+
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "azertyuiop", "qwertzuiop"}
+
+var l33tTable = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i',
+	'|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z',
+}
+
+// bruteforceCardinality is the guesses per character nothing else matched
+const bruteforceCardinality = 10
+
+// minMatchGuesses keeps many cheap matches in a row from looking free
+const minMatchGuesses = 10
+
+type passwordMatch struct {
+	start, end int
+	guesses    float64
+}
+
+func EstimatePasswordStrength(password string, userInputs ...string) PasswordStrength {
+	runes := []rune(password)
+	if len(runes) > 100 {
+		runes = runes[:100]
+	}
+
+	inputs := map[string]bool{}
+	for _, input := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len([]rune(part)) >= 3 {
+				inputs[part] = true
+			}
+		}
+	}
+
+	byEnd := make([][]passwordMatch, len(runes)+1)
+	for _, match := range findPasswordMatches(runes, inputs) {
+		byEnd[match.end] = append(byEnd[match.end], match)
+	}
+
+	// best[k] is the fewest guesses covering the first k characters
+	best := make([]float64, len(runes)+1)
+	best[0] = 1
+	for k := 1; k <= len(runes); k++ {
+		best[k] = best[k-1] * bruteforceCardinality
+		for _, match := range byEnd[k] {
+			if guesses := best[match.start] * math.Max(match.guesses, minMatchGuesses); guesses < best[k] {
+				best[k] = guesses
+			}
+		}
+	}
+
+	guesses := best[len(runes)]
+	score := 4
+	for i, threshold := range []float64{1e3, 1e6, 1e8, 1e10} {
+		if guesses < threshold+5 {
+			score = i
+			break
+		}
+	}
+	return PasswordStrength{Guesses: guesses, Score: score}
+}
+
+func findPasswordMatches(runes []rune, inputs map[string]bool) []passwordMatch {
+	var matches []passwordMatch
+	lower := []rune(strings.ToLower(string(runes)))
+	unl33t := make([]rune, len(lower))
+	for i, r := range lower {
+		if plain, ok := l33tTable[r]; ok {
+			unl33t[i] = plain
+		} else {
+			unl33t[i] = r
+		}
+	}
+
+	for i := 0; i < len(runes); i++ {
+		for j := i + 3; j <= len(runes); j++ {
+			word, plain := string(lower[i:j]), string(unl33t[i:j])
+			variations := uppercaseVariations(runes[i:j])
+
+			for _, candidate := range []struct {
+				word   string
+				factor float64
+			}{{word, 1}, {plain, l33tVariations(lower[i:j], unl33t[i:j])}, {reverse(word), 2}} {
+				if inputs[candidate.word] {
+					matches = append(matches, passwordMatch{i, j, variations * candidate.factor})
+				}
+				if rank, ok := passwordRanks[candidate.word]; ok {
+					matches = append(matches, passwordMatch{i, j, float64(rank) * variations * candidate.factor})
+				}
+			}
+
+			for _, row := range keyboardRows {
+				if strings.Contains(row, word) || strings.Contains(row, reverse(word)) {
+					matches = append(matches, passwordMatch{i, j, 40 * float64(j-i)})
+					break
+				}
+			}
+
+			if isYear(word) {
+				matches = append(matches, passwordMatch{i, j, 120})
+			}
+			if isDate(word) {
+				matches = append(matches, passwordMatch{i, j, 365 * 120})
+			}
+		}
+	}
+
+	// Repeats and sequences only count as a whole run
+	for i := 0; i < len(runes); {
+		j := i + 1
+		for j < len(runes) && lower[j] == lower[i] {
+			j++
+		}
+		if j-i >= 3 {
+			matches = append(matches, passwordMatch{i, j, bruteforceCardinality * float64(j-i)})
+		}
+		i = j
+	}
+	for i := 0; i+2 < len(runes); {
+		delta := lower[i+1] - lower[i]
+		j := i + 1
+		for j < len(runes) && lower[j]-lower[j-1] == delta && (delta == 1 || delta == -1) {
+			j++
+		}
+		if j-i >= 3 {
+			base := 26.0
+			if unicode.IsDigit(lower[i]) {
+				base = 10
+			}
+			if delta < 0 {
+				base *= 2
+			}
+			matches = append(matches, passwordMatch{i, j, base * float64(j-i)})
+			i = j - 1
+			continue
+		}
+		i++
+	}
+	return matches
+}
+
+// uppercaseVariations counts the ways a word may have been capitalized
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word), upper == 1 && unicode.IsUpper(word[0]), upper == 1 && unicode.IsUpper(word[len(word)-1]):
+		return 2
+	default:
+		return math.Pow(2, float64(upper))
+	}
+}
+
+func l33tVariations(word []rune, plain []rune) float64 {
+	substituted := 0
+	for i := range word {
+		if word[i] != plain[i] {
+			substituted++
+		}
+	}
+	return math.Pow(2, float64(substituted))
+}
+
+func isYear(word string) bool {
+	return len(word) == 4 && (strings.HasPrefix(word, "19") || strings.HasPrefix(word, "20")) && isDigits(word)
+}
+
+// isDate recognizes ddmmyyyy, mmddyyyy and yyyymmdd dates without separators
+func isDate(word string) bool {
+	if len(word) != 8 || !isDigits(word) {
+		return false
+	}
+	validDayMonth := func(dm string) bool {
+		a, b := int(dm[0]-'0')*10+int(dm[1]-'0'), int(dm[2]-'0')*10+int(dm[3]-'0')
+		return (a >= 1 && a <= 31 && b >= 1 && b <= 12) || (a >= 1 && a <= 12 && b >= 1 && b <= 31)
+	}
+	return (isYear(word[4:]) && validDayMonth(word[:4])) || (isYear(word[:4]) && validDayMonth(word[4:]))
+}
+
+func isDigits(word string) bool {
+	for _, r := range word {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(word string) string {
+	runes := []rune(word)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
@@ -0,0 +1,83 @@
+package utils
+
+// Lexicographic ranks let a todo be moved between two neighbours by writing only
+// the moved row: RankBetween always returns a key that sorts strictly between
+// its arguments, where "" stands for the open start or end of the list.
+
+const (
+	rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rankBase   = len(rankDigits)
+)
+
+func rankDigit(rank string, i int) int {
+	if i >= len(rank) {
+		return 0
+	}
+	for d := 0; d < rankBase; d++ {
+		if rankDigits[d] == rank[i] {
+			return d
+		}
+	}
+	return 0
+}
+
+// RankBetween returns a rank sorting after prev and before next
+func RankBetween(prev string, next string) string {
+	var rank []byte
+	for i := 0; ; i++ {
+		low := rankDigit(prev, i)
+		high := rankBase
+		if next != "" {
+			high = rankDigit(next, i)
+			if i >= len(next) {
+				high = rankBase
+			}
+		}
+
+		if high-low > 1 {
+			return string(append(rank, rankDigits[(low+high)/2]))
+		}
+
+		rank = append(rank, rankDigits[low])
+		if high-low == 1 {
+			// Fixed the prefix below next, from here on only prev bounds us
+			next = ""
+		}
+	}
+}
+
+// RankAfter returns a short rank sorting after prev, used when appending
+func RankAfter(prev string) string {
+	for i := 0; ; i++ {
+		if d := rankDigit(prev, i); d < rankBase-1 {
+			if i >= len(prev) {
+				return prev + string(rankDigits[d+1])
+			}
+			return prev[:i] + string(rankDigits[d+1])
+		}
+	}
+}
+
+// RankSequence returns n evenly spaced ranks of equal length, used to rebalance a
+// list whose ranks collided or grew too long
+func RankSequence(n int) []string {
+	width, space := 1, rankBase
+	for space <= n {
+		width++
+		space *= rankBase
+	}
+	step := space / (n + 1)
+
+	ranks := make([]string, n)
+	for k := range ranks {
+		value := (k + 1) * step
+		rank := make([]byte, width)
+		for i := width - 1; i >= 0; i-- {
+			rank[i] = rankDigits[value%rankBase]
+			value /= rankBase
+		}
+		// a trailing "i" keeps every rank from ending in the lowest digit
+		ranks[k] = string(rank) + "i"
+	}
+	return ranks
+}
@@ -0,0 +1,324 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is the subset of RFC 5545 recurrence rules todos support:
+// FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, BYDAY, BYMONTHDAY, WKST, UNTIL
+// and COUNT
+type RRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []RRuleDay
+	ByMonthDay []int
+	// WeekStart is the WKST of the rule, nil when it has none and weeks start
+	// on monday
+	WeekStart *time.Weekday
+	Until     *time.Time
+	Count     int
+}
+
+// RRuleDay is a BYDAY entry. Ordinal is only used by monthly rules, e.g. -1FR is
+// the last friday of the month; 0 means every such weekday.
+type RRuleDay struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// maxRRulePeriods bounds the expansion of rules that never produce an occurrence
+const maxRRulePeriods = 10000
+
+func ParseRRule(rule string) (*RRule, error) {
+	r := &RRule{Interval: 1}
+
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("rrule: invalid part %q", part)
+		}
+		key, value := strings.ToUpper(pair[0]), strings.ToUpper(pair[1])
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.Freq = value
+			default:
+				return nil, fmt.Errorf("rrule: unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("rrule: invalid INTERVAL %q", value)
+			}
+			r.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("rrule: invalid COUNT %q", value)
+			}
+			r.Count = count
+		case "UNTIL":
+			until, err := parseRRuleTime(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				if len(day) < 2 {
+					return nil, fmt.Errorf("rrule: invalid BYDAY %q", day)
+				}
+				weekday, ok := rruleWeekdays[day[len(day)-2:]]
+				if !ok {
+					return nil, fmt.Errorf("rrule: invalid BYDAY %q", day)
+				}
+				ordinal := 0
+				if prefix := day[:len(day)-2]; prefix != "" {
+					var err error
+					ordinal, err = strconv.Atoi(prefix)
+					if err != nil || ordinal == 0 || ordinal < -5 || ordinal > 5 {
+						return nil, fmt.Errorf("rrule: invalid BYDAY %q", day)
+					}
+				}
+				r.ByDay = append(r.ByDay, RRuleDay{ordinal, weekday})
+			}
+		case "WKST":
+			weekday, ok := rruleWeekdays[value]
+			if !ok {
+				return nil, fmt.Errorf("rrule: invalid WKST %q", value)
+			}
+			r.WeekStart = &weekday
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					return nil, fmt.Errorf("rrule: invalid BYMONTHDAY %q", day)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, monthDay)
+			}
+		default:
+			return nil, fmt.Errorf("rrule: unsupported part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("rrule: FREQ is required")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return nil, fmt.Errorf("rrule: COUNT and UNTIL are mutually exclusive")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != "MONTHLY" {
+		return nil, fmt.Errorf("rrule: BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	for _, day := range r.ByDay {
+		if r.Freq != "WEEKLY" && r.Freq != "MONTHLY" {
+			return nil, fmt.Errorf("rrule: BYDAY is only supported with FREQ=WEEKLY or MONTHLY")
+		}
+		if day.Ordinal != 0 && r.Freq != "MONTHLY" {
+			return nil, fmt.Errorf("rrule: BYDAY ordinals are only supported with FREQ=MONTHLY")
+		}
+	}
+	return r, nil
+}
+
+func parseRRuleTime(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("rrule: invalid UNTIL %q", value)
+}
+
+// String formats the rule back into its RRULE value
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = rruleWeekday(day.Weekday)
+			if day.Ordinal != 0 {
+				days[i] = strconv.Itoa(day.Ordinal) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != nil {
+		parts = append(parts, "WKST="+rruleWeekday(*r.WeekStart))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	return strings.Join(parts, ";")
+}
+
+func rruleWeekday(weekday time.Weekday) string {
+	return strings.ToUpper(weekday.String()[:2])
+}
+
+// Between returns up to limit occurrences of a series starting at dtstart that fall
+// strictly after the given time, together with their 1-based index in the series.
+// The series start always counts as its first occurrence.
+func (r *RRule) Between(dtstart time.Time, after time.Time, limit int) ([]time.Time, []int) {
+	var occurrences []time.Time
+	var indexes []int
+
+	index := 0
+	emit := func(t time.Time) bool {
+		if r.Until != nil && t.After(*r.Until) {
+			return false
+		}
+		index++
+		if r.Count > 0 && index > r.Count {
+			return false
+		}
+		if t.After(after) {
+			occurrences = append(occurrences, t)
+			indexes = append(indexes, index)
+		}
+		return len(occurrences) < limit
+	}
+
+	if limit <= 0 || !emit(dtstart) {
+		return occurrences, indexes
+	}
+
+	for period := 0; period < maxRRulePeriods; period++ {
+		for _, t := range r.expand(dtstart, period) {
+			if !t.After(dtstart) {
+				continue
+			}
+			if !emit(t) {
+				return occurrences, indexes
+			}
+		}
+	}
+	return occurrences, indexes
+}
+
+// Next returns the occurrence following the one at the given time
+func (r *RRule) Next(dtstart time.Time, current time.Time) (time.Time, int, bool) {
+	occurrences, indexes := r.Between(dtstart, current, 1)
+	if len(occurrences) == 0 {
+		return time.Time{}, 0, false
+	}
+	return occurrences[0], indexes[0], true
+}
+
+// expand lists the sorted candidate times of one period of the rule
+func (r *RRule) expand(dtstart time.Time, period int) []time.Time {
+	step := period * r.Interval
+	hour, min, sec := dtstart.Clock()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, dtstart.Location())
+	}
+
+	var candidates []time.Time
+	switch r.Freq {
+	case "DAILY":
+		candidates = append(candidates, dtstart.AddDate(0, 0, step))
+
+	case "WEEKLY":
+		// Weeks start on WKST, monday by default as in RFC 5545
+		weekStart := time.Monday
+		if r.WeekStart != nil {
+			weekStart = *r.WeekStart
+		}
+		offset := (int(dtstart.Weekday()) - int(weekStart) + 7) % 7
+		first := dtstart.AddDate(0, 0, 7*step-offset)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []RRuleDay{{Weekday: dtstart.Weekday()}}
+		}
+		for _, day := range days {
+			candidates = append(candidates, first.AddDate(0, 0, (int(day.Weekday)-int(weekStart)+7)%7))
+		}
+
+	case "MONTHLY":
+		first := time.Date(dtstart.Year(), dtstart.Month()+time.Month(step), 1, 0, 0, 0, 0, dtstart.Location())
+		year, month := first.Year(), first.Month()
+		length := daysIn(year, month)
+
+		monthDays := r.ByMonthDay
+		if len(monthDays) == 0 && len(r.ByDay) == 0 {
+			monthDays = []int{dtstart.Day()}
+		}
+		for _, day := range monthDays {
+			if day < 0 {
+				day = length + day + 1
+			}
+			if day >= 1 && day <= length {
+				candidates = append(candidates, at(year, month, day))
+			}
+		}
+		for _, day := range r.ByDay {
+			var matches []int
+			for d := 1; d <= length; d++ {
+				if time.Date(year, month, d, 0, 0, 0, 0, dtstart.Location()).Weekday() == day.Weekday {
+					matches = append(matches, d)
+				}
+			}
+			switch {
+			case day.Ordinal == 0:
+				for _, d := range matches {
+					candidates = append(candidates, at(year, month, d))
+				}
+			case day.Ordinal > 0 && day.Ordinal <= len(matches):
+				candidates = append(candidates, at(year, month, matches[day.Ordinal-1]))
+			case day.Ordinal < 0 && -day.Ordinal <= len(matches):
+				candidates = append(candidates, at(year, month, matches[len(matches)+day.Ordinal]))
+			}
+		}
+
+	case "YEARLY":
+		year := dtstart.Year() + step
+		if dtstart.Day() <= daysIn(year, dtstart.Month()) {
+			candidates = append(candidates, at(year, dtstart.Month(), dtstart.Day()))
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	unique := candidates[:0]
+	for i, t := range candidates {
+		if i == 0 || !t.Equal(candidates[i-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRRuleWeekStart(t *testing.T) {
+	// The RFC 5545 example of a rule whose occurrences depend on WKST
+	dtstart := time.Date(1997, 8, 5, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		rule string
+		days []int
+	}{
+		{"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO", []int{5, 10, 19, 24}},
+		{"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU", []int{5, 17, 19, 31}},
+		{"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU", []int{5, 10, 19, 24}},
+	}
+	for _, test := range tests {
+		rule, err := ParseRRule(test.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		occurrences, _ := rule.Between(dtstart, dtstart.Add(-time.Second), 10)
+		if len(occurrences) != len(test.days) {
+			t.Fatalf("%s: got %v", test.rule, occurrences)
+		}
+		for i, day := range test.days {
+			if want := time.Date(1997, 8, day, 9, 0, 0, 0, time.UTC); !occurrences[i].Equal(want) {
+				t.Errorf("%s: occurrence %d is %v, want %v", test.rule, i+1, occurrences[i], want)
+			}
+		}
+	}
+}
+
+func TestRRuleString(t *testing.T) {
+	for rule, want := range map[string]string{
+		"FREQ=WEEKLY;WKST=su;BYDAY=MO,FR": "FREQ=WEEKLY;BYDAY=MO,FR;WKST=SU",
+		"RRULE:FREQ=MONTHLY;BYDAY=-1FR":   "FREQ=MONTHLY;BYDAY=-1FR",
+	} {
+		parsed, err := ParseRRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parsed.String(); got != want {
+			t.Errorf("%s: got %s, want %s", rule, got, want)
+		}
+	}
+	if _, err := ParseRRule("FREQ=WEEKLY;WKST=XX"); err == nil {
+		t.Error("parsed an invalid WKST")
+	}
+}
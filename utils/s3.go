@@ -0,0 +1,269 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3MaxURLLifetime = 7 * 24 * time.Hour
+)
+
+var s3Client = &http.Client{Timeout: 60 * time.Second}
+
+// S3Storage keeps blobs in a bucket of S3 or of a compatible server such as
+// MinIO, signing its requests with AWS signature version 4
+type S3Storage struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket as endpoint/bucket rather than as
+	// bucket.endpoint
+	PathStyle bool
+}
+
+func (s *S3Storage) Put(key string, content []byte, contentType string) error {
+	request, err := s.request(http.MethodPut, key, content)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	return s.do(request, nil)
+}
+
+func (s *S3Storage) Open(key string) (io.ReadCloser, error) {
+	request, err := s.request(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s3Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusNotFound {
+		response.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		return nil, s3Error(request, response)
+	}
+	return response.Body, nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	request, err := s.request(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	return s.do(request, []int{http.StatusNotFound})
+}
+
+// SignedURL presigns a download of the blob, which S3 serves under the name
+// with the content type
+func (s *S3Storage) SignedURL(key string, name string, contentType string, expires time.Time) (string, error) {
+	return s.presign(key, name, contentType, expires, time.Now())
+}
+
+func (s *S3Storage) presign(key string, name string, contentType string, expires time.Time, now time.Time) (string, error) {
+	lifetime := expires.Sub(now).Round(time.Second)
+	if lifetime <= 0 || lifetime > s3MaxURLLifetime {
+		return "", fmt.Errorf("s3: signed urls last up to %s", s3MaxURLLifetime)
+	}
+	target, err := s.url(key)
+	if err != nil {
+		return "", err
+	}
+
+	now = now.UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.AccessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(lifetime.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if name != "" {
+		query.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	if contentType != "" {
+		query.Set("response-content-type", contentType)
+	}
+	target.RawQuery = s3Query(query)
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		target.EscapedPath(),
+		target.RawQuery,
+		"host:" + target.Host + "\n",
+		"host",
+		s3UnsignedBody,
+	}, "\n")
+	target.RawQuery += "&X-Amz-Signature=" + s.signature(canonical, now)
+	return target.String(), nil
+}
+
+// request builds a request signed in its headers, with the hash of the body
+func (s *S3Storage) request(method string, key string, body []byte) (*http.Request, error) {
+	target, err := s.url(key)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(body)
+	s.signRequest(request, hex.EncodeToString(sum[:]), time.Now())
+	return request, nil
+}
+
+// signRequest signs the host and the headers set on the request so far, headers
+// set afterwards aren't covered by the signature
+func (s *S3Storage) signRequest(request *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	request.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		s3Query(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKeyID, s.scope(now), signedHeaders, s.signature(canonical, now)))
+}
+
+// do sends a request, accepting a 2xx status or one of the statuses given
+func (s *S3Storage) do(request *http.Request, accepted []int) error {
+	response, err := s3Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 == 2 {
+		return nil
+	}
+	for _, status := range accepted {
+		if response.StatusCode == status {
+			return nil
+		}
+	}
+	return s3Error(request, response)
+}
+
+func (s *S3Storage) url(key string) (*url.URL, error) {
+	if key == "" {
+		return nil, ErrInvalidBlobKey
+	}
+	target, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.PathStyle {
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		target.Host = s.Bucket + "." + target.Host
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + key
+	}
+	// S3 expects every character but the unreserved ones and slashes escaped
+	target.RawPath = s3Escape(target.Path, false)
+	return target, nil
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+func (s *S3Storage) signature(canonical string, now time.Time) string {
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format("20060102T150405Z"),
+		s.scope(now),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+
+	key := s3HMAC([]byte("AWS4"+s.SecretAccessKey), now.Format("20060102"))
+	key = s3HMAC(key, s.Region)
+	key = s3HMAC(key, "s3")
+	key = s3HMAC(key, "aws4_request")
+	return hex.EncodeToString(s3HMAC(key, stringToSign))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Query encodes a query the way it is signed: sorted by name, with every
+// character but the unreserved ones escaped
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3Escape(name, true)+"="+s3Escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Escape(value string, escapeSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !escapeSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func s3Error(request *http.Request, response *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("s3: %s %s: %s %s", request.Method, request.URL.Path, response.Status, strings.TrimSpace(string(body)))
+}
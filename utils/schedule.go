@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"log"
+	"time"
+)
+
+// Schedule runs job every interval in its own goroutine until the process exits
+func Schedule(name string, interval time.Duration, job func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := job(); err != nil {
+				log.Println("scheduled job", name, "failed:", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang/config"
+)
+
+var (
+	ErrBlobNotFound     = errors.New("blob not found")
+	ErrInvalidBlobKey   = errors.New("invalid blob key")
+	ErrInvalidSignedURL = errors.New("the link is invalid or expired")
+)
+
+// Storage keeps the blobs of attachments under keys such as todos/1/abc
+type Storage interface {
+	Put(key string, content []byte, contentType string) error
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes a blob, succeeding when it is gone already
+	Delete(key string) error
+	// SignedURL links to a blob until it expires, without any other credential.
+	// The blob is downloaded under the name with the content type.
+	SignedURL(key string, name string, contentType string, expires time.Time) (string, error)
+}
+
+// NewStorage returns the storage STORAGE_DRIVER selects: local or s3
+func NewStorage(config config.Config) (Storage, error) {
+	switch config.StorageDriver {
+	case "local":
+		secret := []byte(config.StorageURLSecret)
+		if len(secret) == 0 {
+			log.Println("STORAGE_URL_SECRET is unset, attachment links stop working on restart")
+			secret = make([]byte, 32)
+			if _, err := rand.Read(secret); err != nil {
+				return nil, err
+			}
+		}
+		return &LocalStorage{
+			Dir:     config.StorageDir,
+			BaseURL: strings.TrimSuffix(config.BaseUrl, "/") + "/api/todo/attachments/blob",
+			Secret:  secret,
+		}, nil
+	case "s3":
+		if config.S3Bucket == "" || config.S3AccessKeyID == "" || config.S3SecretAccessKey == "" {
+			return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+		}
+		return &S3Storage{
+			Endpoint:        config.S3Endpoint,
+			Region:          config.S3Region,
+			Bucket:          config.S3Bucket,
+			AccessKeyID:     config.S3AccessKeyID,
+			SecretAccessKey: config.S3SecretAccessKey,
+			PathStyle:       config.S3PathStyle,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", config.StorageDriver)
+}
+
+// LocalStorage keeps blobs as files in a directory. Its signed URLs point at the
+// API, which checks the signature with VerifyURL before serving the blob.
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+	Secret  []byte
+}
+
+func (ls *LocalStorage) Put(key string, content []byte, contentType string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// Writing aside and renaming never leaves a partial blob behind
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, content, 0o600); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+func (ls *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrBlobNotFound
+	}
+	return file, err
+}
+
+func (ls *LocalStorage) Delete(key string) error {
+	path, err := ls.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (ls *LocalStorage) SignedURL(key string, name string, contentType string, expires time.Time) (string, error) {
+	if _, err := ls.path(key); err != nil {
+		return "", err
+	}
+	query := url.Values{}
+	query.Set("key", key)
+	query.Set("name", name)
+	query.Set("type", contentType)
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", ls.sign(key, name, contentType, query.Get("expires")))
+	return ls.BaseURL + "?" + query.Encode(), nil
+}
+
+// VerifyURL checks the query of a signed URL and returns the key, name and
+// content type of the blob it links to
+func (ls *LocalStorage) VerifyURL(query url.Values, now time.Time) (string, string, string, error) {
+	key, name, contentType := query.Get("key"), query.Get("name"), query.Get("type")
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", "", "", ErrInvalidSignedURL
+	}
+
+	signature := ls.sign(key, name, contentType, query.Get("expires"))
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(query.Get("signature"))) != 1 {
+		return "", "", "", ErrInvalidSignedURL
+	}
+	return key, name, contentType, nil
+}
+
+func (ls *LocalStorage) sign(key string, name string, contentType string, expires string) string {
+	mac := hmac.New(sha256.New, ls.Secret)
+	// The parts are joined with a byte none of them contains
+	mac.Write([]byte(strings.Join([]string{key, name, contentType, expires}, "\x00")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path maps a key into the directory, refusing keys that would leave it
+func (ls *LocalStorage) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\x00\\") {
+		return "", ErrInvalidBlobKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", ErrInvalidBlobKey
+		}
+	}
+	return filepath.Join(ls.Dir, filepath.FromSlash(key)), nil
+}
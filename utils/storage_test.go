@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLocalStorage(t *testing.T) *LocalStorage {
+	return &LocalStorage{
+		Dir:     t.TempDir(),
+		BaseURL: "https://todo.example.com/api/todo/attachments/blob",
+		Secret:  []byte("secret"),
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	storage := newLocalStorage(t)
+
+	if err := storage.Put("todos/1/abc", []byte("hello"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := storage.Open("todos/1/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(content) != "hello" {
+		t.Errorf("opened %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(storage.Dir, "todos", "1", "abc.tmp")); !os.IsNotExist(err) {
+		t.Errorf("left the temporary file behind: %v", err)
+	}
+
+	if err := storage.Delete("todos/1/abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Delete("todos/1/abc"); err != nil {
+		t.Errorf("deleting twice: %v", err)
+	}
+	if _, err := storage.Open("todos/1/abc"); err != ErrBlobNotFound {
+		t.Errorf("opened a deleted blob: %v", err)
+	}
+}
+
+func TestLocalStoragePath(t *testing.T) {
+	storage := newLocalStorage(t)
+
+	for _, key := range []string{"", "../x", "todos/../../x", "/etc/passwd", "a//b", "a/./b", "a/", ".", "a\\b", "..\\x", "a\x00b"} {
+		if _, err := storage.path(key); err != ErrInvalidBlobKey {
+			t.Errorf("%q: %v", key, err)
+		}
+		if err := storage.Put(key, []byte("x"), "text/plain"); err != ErrInvalidBlobKey {
+			t.Errorf("put %q: %v", key, err)
+		}
+		if _, err := storage.SignedURL(key, "x", "text/plain", time.Now().Add(time.Minute)); err != ErrInvalidBlobKey {
+			t.Errorf("signed %q: %v", key, err)
+		}
+	}
+
+	path, err := storage.path("todos/1/a..b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(path, storage.Dir+string(filepath.Separator)) {
+		t.Errorf("%q is outside of %q", path, storage.Dir)
+	}
+}
+
+func TestLocalStorageVerifyURL(t *testing.T) {
+	storage := newLocalStorage(t)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	signed, err := storage.SignedURL("todos/1/abc", "notes.txt", "text/plain", now.Add(15*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed, storage.BaseURL+"?") {
+		t.Fatalf("unexpected link: %s", signed)
+	}
+	link, _ := url.Parse(signed)
+
+	key, name, contentType, err := storage.VerifyURL(link.Query(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "todos/1/abc" || name != "notes.txt" || contentType != "text/plain" {
+		t.Errorf("got %q %q %q", key, name, contentType)
+	}
+	if _, _, _, err := storage.VerifyURL(link.Query(), now.Add(15*time.Minute)); err != nil {
+		t.Errorf("rejected until it expires: %v", err)
+	}
+	if _, _, _, err := storage.VerifyURL(link.Query(), now.Add(15*time.Minute+time.Second)); err != ErrInvalidSignedURL {
+		t.Errorf("expired link: %v", err)
+	}
+
+	for param, value := range map[string]string{
+		"key":       "todos/2/abc",
+		"name":      "notes.html",
+		"type":      "text/html",
+		"expires":   "99999999999",
+		"signature": strings.Repeat("0", 64),
+	} {
+		query := link.Query()
+		query.Set(param, value)
+		if _, _, _, err := storage.VerifyURL(query, now); err != ErrInvalidSignedURL {
+			t.Errorf("tampered %s: %v", param, err)
+		}
+		query.Del(param)
+		if _, _, _, err := storage.VerifyURL(query, now); err != ErrInvalidSignedURL {
+			t.Errorf("without %s: %v", param, err)
+		}
+	}
+
+	other := &LocalStorage{Dir: storage.Dir, BaseURL: storage.BaseURL, Secret: []byte("other")}
+	if _, _, _, err := other.VerifyURL(link.Query(), now); err != ErrInvalidSignedURL {
+		t.Errorf("signed with another secret: %v", err)
+	}
+}
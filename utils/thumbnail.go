@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// ThumbnailSize bounds the width and height of a thumbnail
+	ThumbnailSize = 256
+	// thumbnailMaxPixels refuses images that would take too much memory to
+	// decode, whatever the size of their file
+	thumbnailMaxPixels = 50000000
+)
+
+var ErrUnsupportedImage = errors.New("the image could not be read")
+
+// Thumbnail scales an image in JPEG, PNG or GIF down to fit in ThumbnailSize
+// square, keeping its aspect ratio, and encodes it as JPEG
+func Thumbnail(content []byte) ([]byte, error) {
+	size, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || size.Width <= 0 || size.Height <= 0 || size.Width*size.Height > thumbnailMaxPixels {
+		return nil, ErrUnsupportedImage
+	}
+	source, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	width, height := size.Width, size.Height
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			width, height = ThumbnailSize, atLeast(height*ThumbnailSize/width, 1)
+		} else {
+			width, height = atLeast(width*ThumbnailSize/height, 1), ThumbnailSize
+		}
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, scaleImage(source, width, height), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// scaleImage averages the pixels of the source falling in each pixel of the
+// result, on a white background since JPEG has no transparency
+func scaleImage(source image.Image, width int, height int) *image.RGBA {
+	bounds := source.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := atLeast(bounds.Min.Y+(y+1)*bounds.Dy()/height, top+1)
+		for x := 0; x < width; x++ {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := atLeast(bounds.Min.X+(x+1)*bounds.Dx()/width, left+1)
+
+			var r, g, b, count uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					pr, pg, pb, pa := source.At(sx, sy).RGBA()
+					// Blend the premultiplied color over white
+					r += uint64(pr + 0xffff - pa)
+					g += uint64(pg + 0xffff - pa)
+					b += uint64(pb + 0xffff - pa)
+					count++
+				}
+			}
+			result.Set(x, y, color.RGBA64{R: uint16(r / count), G: uint16(g / count), B: uint16(b / count), A: 0xffff})
+		}
+	}
+	return result
+}
+
+func atLeast(value int, minimum int) int {
+	if value < minimum {
+		return minimum
+	}
+	return value
+}
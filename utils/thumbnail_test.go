@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width int, height int) []byte {
+	source := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			source.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, source); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          image.Point
+	}{
+		{1024, 512, image.Pt(256, 128)},
+		{300, 900, image.Pt(85, 256)},
+		{2000, 1, image.Pt(256, 1)},
+		// Small images aren't scaled up
+		{100, 50, image.Pt(100, 50)},
+	}
+	for _, test := range tests {
+		thumbnail, err := Thumbnail(encodePNG(t, test.width, test.height))
+		if err != nil {
+			t.Fatalf("%dx%d: %v", test.width, test.height, err)
+		}
+		decoded, err := jpeg.Decode(bytes.NewReader(thumbnail))
+		if err != nil {
+			t.Fatalf("%dx%d: not a JPEG: %v", test.width, test.height, err)
+		}
+		if size := decoded.Bounds().Size(); size != test.want {
+			t.Errorf("%dx%d: got %v, want %v", test.width, test.height, size, test.want)
+		}
+	}
+}
+
+func TestThumbnailTransparency(t *testing.T) {
+	var out bytes.Buffer
+	png.Encode(&out, image.NewNRGBA(image.Rect(0, 0, 8, 8)))
+	thumbnail, err := Thumbnail(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := jpeg.Decode(bytes.NewReader(thumbnail))
+	if r, g, b, _ := decoded.At(4, 4).RGBA(); r < 0xf000 || g < 0xf000 || b < 0xf000 {
+		t.Errorf("transparent pixels aren't white: %d %d %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestThumbnailUnsupported(t *testing.T) {
+	for name, content := range map[string][]byte{
+		"text":      []byte("not an image"),
+		"truncated": encodePNG(t, 64, 64)[:60],
+		"empty":     nil,
+	} {
+		if _, err := Thumbnail(content); err != ErrUnsupportedImage {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -1,33 +1,27 @@
 package utils
 
 import (
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 )
 
-func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (string, error) {
-	decodedPrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
-	if err != nil {
-		return "", fmt.Errorf("could not decode key: %w", err)
-	}
-	key, err := jwt.ParseRSAPrivateKeyFromPEM(decodedPrivateKey)
-
-	if err != nil {
-		return "", fmt.Errorf("create: parse key: %w", err)
-	}
+func CreateToken(ttl time.Duration, payload interface{}, keys *KeySet) (string, error) {
+	return CreateTokenWithClaims(ttl, jwt.MapClaims{"sub": payload}, keys)
+}
 
+// CreateTokenWithClaims signs a token carrying extra claims next to the
+// subject, such as the scopes of an OAuth access token
+func CreateTokenWithClaims(ttl time.Duration, claims jwt.MapClaims, keys *KeySet) (string, error) {
 	now := time.Now().UTC()
 
-	claims := make(jwt.MapClaims)
-	claims["sub"] = payload
 	claims["exp"] = now.Add(ttl).Unix()
 	claims["iat"] = now.Unix()
 	claims["nbf"] = now.Unix()
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	token, err := keys.sign(claims)
 
 	if err != nil {
 		return "", fmt.Errorf("create: sign token: %w", err)
@@ -36,33 +30,58 @@ func CreateToken(ttl time.Duration, payload interface{}, privateKey string) (str
 	return token, nil
 }
 
-func ValidateToken(token string, publicKey string) (interface{}, error) {
-	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKey)
+func ValidateToken(token string, keys *KeySet) (interface{}, error) {
+	claims, err := ParseToken(token, keys)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode: %w", err)
+		return nil, err
 	}
+	return claims["sub"], nil
+}
 
-	key, err := jwt.ParseRSAPublicKeyFromPEM(decodedPublicKey)
-
+// ParseToken validates a token against the keys of the set and returns all of
+// its claims
+func ParseToken(token string, keys *KeySet) (jwt.MapClaims, error) {
+	var parser jwt.Parser
+	unverified, _, err := parser.ParseUnverified(token, jwt.MapClaims{})
 	if err != nil {
-		return "", fmt.Errorf("validate: parse key: %w", err)
+		return nil, fmt.Errorf("validate: %w", err)
 	}
+	kid, _ := unverified.Header["kid"].(string)
 
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("unexpected method: %s", t.Header["alg"])
+	candidates := keys.verificationKeys(kid)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("validate: unknown key %q", kid)
+	}
+
+	for _, key := range candidates {
+		parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("unexpected method: %s", t.Header["alg"])
+			}
+			return key, nil
+		})
+
+		// Tokens without a key id are tried against every key
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0 && len(candidates) > 1 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("validate: %w", err)
 		}
-		return key, nil
-	})
 
-	if err != nil {
-		return nil, fmt.Errorf("validate: %w", err)
-	}
+		claims, ok := parsedToken.Claims.(jwt.MapClaims)
+		if !ok || !parsedToken.Valid {
+			return nil, fmt.Errorf("validate: invalid token")
+		}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok || !parsedToken.Valid {
-		return nil, fmt.Errorf("validate: invalid token")
+		return claims, nil
 	}
+	return nil, fmt.Errorf("validate: signature is invalid")
+}
 
-	return claims["sub"], nil
+// IssuedBefore tells whether the token of the claims was issued before t
+func IssuedBefore(claims jwt.MapClaims, t time.Time) bool {
+	iat, ok := claims["iat"].(float64)
+	return !ok || int64(iat) < t.Unix()
 }